@@ -2,33 +2,127 @@ package config
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/go-envparse"
+	"github.com/lettered/zssld-tools/faults"
 	"github.com/ochinchina/go-ini"
 	log "github.com/sirupsen/logrus"
 )
 
-// Config memory representation of supervisor configuration file
+// the priority of the entries without "priority" key
+const defaultPriority = 999
+
+// Config memory representation of supervisor configuration file.
+//
+// The Config is safe for concurrent use, e.g. the programs can be read by the
+// RPC handlers while the configuration is reloaded. The entries returned are
+// not changed by the later loading, see Generation to detect they are stale
 type Config struct {
+	// guards the loaded configuration below, the loading takes it only to
+	// replace the loaded configuration once the files are parsed
+	lock sync.RWMutex
+	// serializes the loading
+	loadLock sync.Mutex
+	// the number of the successful loadings
+	generation uint64
 	configFile string
+	// the directory of the configuration fragments, see NewConfigDir
+	configDir string
+	// the files overlaid on the configuration file in order
+	overlayFiles []string
+	// the entries built in Go code, see NewConfigFromEntries
+	built []*Entry
 	// mapping between the section name and configuration entry
 	entries map[string]*Entry
+	// mapping between the program name and its configuration entry
+	programs map[string]*Entry
+	// mapping between the group name and the entries of its member programs
+	groups map[string][]*Entry
+	// the loaded configuration files
+	sources map[string]*configSource
+	// the loaded configuration files in the merging order
+	files []string
+	// the declaration order of the sections in the loaded files
+	sectionOrder map[string]int
+	// the locations of the keys in the loaded files by the section name and
+	// the key, the section header is keyed by ""
+	locations map[string]map[string]keyLocation
+	// the directories searched for the include files
+	includeDirs []string
+	// the manifest files of the programs
+	manifests []string
+	// the client fetching the remote configuration files
+	httpClient *http.Client
+	// the problems found while parsing the configuration
+	problems []ValidationError
+	// fail the loading if the configuration is not valid
+	strict bool
+	// load the legacy supervisord sections, see SetSupervisordCompat
+	compat bool
+	// the profile of the [x@profile] sections loaded, see SetProfile
+	profile string
+	// the hook notified of the keys read from the entries, see SetAccessHook
+	access *accessHooks
+	// the loaded extraction of the bundle configuration file, see extractBundle
+	bundle extractedBundle
+	// the logger of the configuration, see SetLogger, and the warnings logged
+	// by the last loading
+	logs     *configLogs
+	warnings []Warning
+	// the logger of the current loading
+	loading *loadLogger
+	// the configuration is a read-only snapshot, see Snapshot
+	snapshot bool
 }
 
 // NewEntry creates configuration entry
 func NewEntry(configDir string) *Entry {
-	return &Entry{configDir, "", "", make(map[string]string)}
+	return &Entry{ConfigDir: configDir,
+		keyValues:   make(map[string]string),
+		modified:    make(map[string]bool),
+		stringCache: make(map[string]string),
+		exprCache:   make(map[string]string),
+		envCache:    make(map[string][]string)}
 }
 
-// NewConfig creates Config object
-func NewConfig(configFile string) *Config {
-	return &Config{configFile, make(map[string]*Entry)}
+// NewConfig creates Config object. The overlayFiles and their include files
+// are merged over the configuration file in order, so the keys in the later
+// files override the same keys in the earlier files, e.g. the configuration
+// shipped with the package can be overlaid with the machine specific one
+func NewConfig(configFile string, overlayFiles ...string) *Config {
+	return &Config{configFile: configFile,
+		overlayFiles: overlayFiles,
+		entries:      make(map[string]*Entry),
+		programs:     make(map[string]*Entry),
+		groups:       make(map[string][]*Entry),
+		sources:      make(map[string]*configSource),
+		access:       &accessHooks{},
+		logs:         &configLogs{}}
+}
+
+// NewConfigDir creates Config object loading every "*.ini" and "*.conf" file
+// in configDir instead of a single configuration file, like the fragments
+// dropped to conf.d by the packages. The fragments are merged in the
+// alphabetical order of their names, so "20-web.conf" overrides the same keys
+// in "10-base.conf", and the overlayFiles are merged over them. The files
+// starting with "." are skipped, and the fragments added or removed are picked
+// up on reload
+func NewConfigDir(configDir string, overlayFiles ...string) *Config {
+	c := NewConfig("", overlayFiles...)
+	c.configDir = configDir
+	return c
 }
 
 // create a new entry or return the already-exist entry
@@ -37,83 +131,478 @@ func (c *Config) createEntry(name string, configDir string) *Entry {
 
 	if !ok {
 		entry = NewEntry(configDir)
+		entry.access, entry.logs = c.access, c.logs
 		c.entries[name] = entry
 	}
 	return entry
 }
 
-// Load the configuration and return loaded programs
+// Load the configuration and return loaded programs.
+//
+// The files with ".yaml" or ".yml" extension are loaded as yaml, with the
+// programs, groups and eventlisteners mappings holding the named sections.
+// The files with ".json" extension have the same layout and are validated
+// against the json schema returned by GetJSONSchema.
+//
+// The ";" and "#" after a space start an inline comment in the ini values
+// unless they are quoted, e.g. command=sh -c "a ; b" ; the comment. The quotes
+// enclosing a whole value are removed except for the commands, which are split
+// to the arguments by their quotes.
+//
+// On Windows the backslashes in the paths starting with a drive letter or
+// "\\" are taken literally, e.g. directory=C:\new\app, the other backslashes
+// in the ini values escape the next char as they do on the other systems.
+//
+// The program and event listener sections with "use_template=x" inherit the
+// keys of the [template:x] section, the keys of [program-default] are applied
+// after the template keys.
+//
+// The "files" of the [include] section are relative to the directory of the
+// file including them, "**" in the patterns matches any number of directories,
+// and the included files can include other files.
+//
+// The program and event listener sections with "manifest=x" take the
+// command, args and environment from the json or env file x, which is
+// relative to the file of the section, see applyManifests.
+//
+// The "directory" of the programs must exist unless "create_dirs=true", in
+// which case it is created by CreateDirs, and "%(program_name)s" is expanded
+// in it.
+//
+// The program and event listener sections with "condition=x" are skipped if
+// the hostname, os or arch conditions x are not met, see parseConditions.
+//
+// The [x@profile] sections override the [x] sections if the profile is
+// loaded, see SetProfile.
+//
+// The [supervisord] and [supervisorctl] sections are loaded as [zssld] and
+// [zsslctl] in the supervisord compatibility mode, see SetSupervisordCompat.
+//
+// The configuration file can be a ".tar.gz", ".tgz", ".tar" or ".zip" bundle
+// of the configuration file named zssld.conf, zssld.ini, zssld.yaml,
+// zssld.yml or zssld.json and its include files, env files and manifests. The
+// bundle is extracted to a new temporary directory when it is changed and
+// the files are loaded through a link to it with the same path on every
+// loading, so "%(here)s" doesn't change and the unchanged programs are kept on
+// reload. The link is switched back if the loading fails, see extractBundle.
+//
+// The configuration file and the include files can be http or https URLs, see
+// SetRemoteOptions, of at most MaxRemoteFileSize bytes. The relative include
+// files of a remote file are resolved against its URL and are not globbed.
+//
+// On reload only the changed files are parsed again and the entries which are
+// not changed are kept
 func (c *Config) Load() ([]string, error) {
+	return c.LoadContext(context.Background())
+}
+
+// LoadContext loads the configuration like Load, the loading is abandoned and
+// the configuration is kept unchanged if ctx is done before all files are loaded
+func (c *Config) LoadContext(ctx context.Context) ([]string, error) {
+	if c.snapshot {
+		return nil, faults.NewFault(faults.CantReread, "the configuration snapshot can't be loaded")
+	}
+	c.loadLock.Lock()
+	defer c.loadLock.Unlock()
+	return c.load(ctx)
+}
+
+// load the configuration with the loadLock held, the loaded configuration is
+// only read without the lock as it is changed by the loading only
+func (c *Config) load(ctx context.Context) ([]string, error) {
+	loading := c.logs.startLoading()
+	c.lock.Lock()
+	c.loading = loading
+	c.lock.Unlock()
+	defer func() {
+		c.logs.endLoading()
+		c.lock.Lock()
+		c.warnings = loading.getWarnings()
+		c.lock.Unlock()
+		loading.flush()
+	}()
+	accepted := false
+	bundle := extractedBundle{}
+	if isBundleFile(c.configFile) {
+		var loaded extractedBundle
+		var err error
+		if bundle, loaded, err = c.extractBundle(); err != nil {
+			return nil, err
+		}
+		defer func() {
+			c.releaseBundle(bundle, loaded, accepted)
+		}()
+	}
+	sources := make(map[string]*configSource)
+	files := make([]string, 0)
+	includeDirs := make([]string, 0)
 	myini := ini.NewIni()
-	log.WithFields(log.Fields{"file": c.configFile}).Info("load configuration from file")
-	myini.LoadFile(c.configFile)
+	configFiles, err := c.getConfigFilePaths(bundle.main)
+	if err != nil {
+		return nil, err
+	}
+	if c.configDir != "" {
+		includeDirs = append(includeDirs, absConfigPath(c.configDir))
+	}
+	for _, configFile := range configFiles {
+		mainSource, err := c.loadSource(ctx, configFile, c.sources[configFile])
+		if err != nil {
+			return nil, err
+		}
+		includeFiles, fileSources, dirs, err := c.loadIncludes(ctx, configFile, mainSource)
+		if err != nil {
+			return nil, err
+		}
+		for f, source := range fileSources {
+			sources[f] = source
+		}
+		for _, f := range append([]string{configFile}, includeFiles...) {
+			mergeIni(myini, sources[f].ini)
+			files = append(files, f)
+		}
+		includeDirs = append(includeDirs, dirs...)
+	}
+	for _, entry := range c.built {
+		section := myini.NewSection(entry.Name)
+		for key, value := range entry.copyKeyValues() {
+			section.Add(key, value)
+		}
+	}
+
+	sectionOrder, locations := indexSources(files, sources)
+	for _, entry := range c.built {
+		if _, ok := sectionOrder[entry.Name]; !ok {
+			sectionOrder[entry.Name] = len(sectionOrder)
+		}
+	}
+	c.lock.RLock()
+	profile, compat := c.getProfile(), c.compat
+	c.lock.RUnlock()
+	myini = applyProfile(myini, profile, sectionOrder, locations, c.loading)
+	if compat {
+		myini = applySupervisordAliases(myini, sectionOrder, locations, c.loading)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	oldEntries, oldPrograms, oldGroups, oldProblems, oldLocations, oldManifests, oldBundle := c.entries, c.programs, c.groups, c.problems, c.locations, c.manifests, c.bundle
+	if bundle.main != "" {
+		c.bundle = bundle
+	}
+	loadedPrograms := c.parse(myini, locations)
+	if c.strict {
+		if errs := c.validate(); len(errs) > 0 {
+			c.entries, c.programs, c.groups, c.problems, c.locations, c.manifests, c.bundle = oldEntries, oldPrograms, oldGroups, oldProblems, oldLocations, oldManifests, oldBundle
+			return nil, ValidationErrors(errs)
+		}
+	}
+	accepted = true
+	c.sources = sources
+	c.files = files
+	c.sectionOrder = sectionOrder
+	c.includeDirs = includeDirs
+	c.generation++
+	return loadedPrograms, nil
+}
+
+// Generation returns the number of the successful loadings of the
+// configuration. It is increased by every Load and Reload, so the values
+// read from the configuration are stale if the generation is changed since
+// they were read
+func (c *Config) Generation() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.generation
+}
+
+// Reload loads the configuration file and its include files again and returns
+// the names of the programs which are added, changed or removed since the last
+// loading. The programs not in any of the lists are kept unchanged and need
+// not be restarted
+func (c *Config) Reload() (added []string, changed []string, removed []string, err error) {
+	return c.ReloadContext(context.Background())
+}
+
+// ReloadContext reloads the configuration like Reload, the reloading is
+// abandoned and the configuration is kept unchanged if ctx is done before all
+// files are loaded, e.g. the remote include files
+func (c *Config) ReloadContext(ctx context.Context) (added []string, changed []string, removed []string, err error) {
+	if c.snapshot {
+		return nil, nil, nil, faults.NewFault(faults.CantReread, "the configuration snapshot can't be loaded")
+	}
+	c.loadLock.Lock()
+	defer c.loadLock.Unlock()
+	oldPrograms := c.programs
+	if _, err = c.load(ctx); err != nil {
+		return nil, nil, nil, err
+	}
+	for name, entry := range c.programs {
+		oldEntry, ok := oldPrograms[name]
+		if !ok {
+			added = append(added, name)
+		} else if oldEntry != entry {
+			// the unchanged entries are kept by parse
+			changed = append(changed, name)
+		}
+	}
+	for name := range oldPrograms {
+		if _, ok := c.programs[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return added, changed, removed, nil
+}
+
+// SetStrict sets the strict mode. In strict mode, Load fails and keeps the
+// configuration unchanged if Validate reports any error
+func (c *Config) SetStrict(strict bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.strict = strict
+}
+
+// the absolute path of the configuration file, the included files are
+// identified by their absolute paths also. The first loaded fragment is the
+// configuration file if loaded from a directory
+func (c *Config) getConfigFilePath() string {
+	if c.configFile == "" && c.configDir != "" {
+		if len(c.files) > 0 {
+			return c.files[0]
+		}
+		return ""
+	}
+	if isBundleFile(c.configFile) {
+		return c.bundle.main
+	}
+	return absConfigPath(c.configFile)
+}
+
+// the absolute paths of the configuration file or the fragments in the
+// configuration directory, followed by the overlay files. bundleMain is the
+// main file of the extracted bundle if the configuration file is a bundle
+func (c *Config) getConfigFilePaths(bundleMain string) ([]string, error) {
+	result := make([]string, 0)
+	if c.configDir != "" {
+		fragments, err := getConfigDirFiles(absConfigPath(c.configDir))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, fragments...)
+	}
+	if isBundleFile(c.configFile) {
+		result = append(result, bundleMain)
+	} else if c.configFile != "" || (c.configDir == "" && len(c.built) == 0) {
+		result = append(result, absConfigPath(c.configFile))
+	}
+	for _, f := range c.overlayFiles {
+		result = append(result, absConfigPath(f))
+	}
+	if len(result) == 0 && len(c.built) == 0 {
+		return nil, fmt.Errorf("%s: no *.ini or *.conf configuration file", c.configDir)
+	}
+	return result, nil
+}
+
+// the "*.ini" and "*.conf" files in the directory in the alphabetical order
+func getConfigDirFiles(dir string) ([]string, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0)
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if ext := filepath.Ext(name); ext == ".ini" || ext == ".conf" {
+			result = append(result, filepath.Join(dir, name))
+		}
+	}
+	// os.ReadDir returns the entries sorted by the file name
+	return result, nil
+}
 
-	includeFiles := c.getIncludeFiles(myini)
-	for _, f := range includeFiles {
-		log.WithFields(log.Fields{"file": f}).Info("load configuration from file")
-		myini.LoadFile(f)
+// the absolute path of the local configuration file or the URL of the remote one
+func absConfigPath(file string) string {
+	if isRemoteFile(file) {
+		return file
+	}
+	if path, err := filepath.Abs(file); err == nil {
+		return path
 	}
-	return c.parse(myini), nil
+	return filepath.Clean(file)
 }
 
-// GetConfigFileDir returns directory of zssld configuration file
+// check if the path is absolute, including the Windows paths rooted at "\"
+// without a drive letter and the paths relative to a drive, e.g. "C:conf"
+func isAbsConfigPath(f string) bool {
+	return filepath.IsAbs(f) || filepath.VolumeName(f) != "" || (f != "" && os.IsPathSeparator(f[0]))
+}
+
+// join the path f relative to the directory dir of a configuration file. The
+// Windows paths with a drive letter are kept, and the paths rooted at "\"
+// without a drive letter are on the drive of dir
+func joinConfigPath(dir string, f string) string {
+	switch {
+	case filepath.IsAbs(f) || filepath.VolumeName(f) != "":
+		return f
+	case f != "" && os.IsPathSeparator(f[0]):
+		return filepath.VolumeName(dir) + f
+	}
+	return filepath.Join(dir, f)
+}
+
+// the directory of the local or remote configuration file
+func sourceDir(file string) string {
+	if isRemoteFile(file) {
+		if u, err := url.Parse(file); err == nil {
+			u.Path = path.Dir(u.Path)
+			u.RawQuery = ""
+			return u.String()
+		}
+	}
+	return filepath.Dir(file)
+}
+
+// GetConfigFileDir returns directory of zssld configuration file, the
+// directory the bundle is extracted to if loaded from a bundle
 func (c *Config) GetConfigFileDir() string {
-	return filepath.Dir(c.configFile)
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.configFileDir()
 }
 
-// GetUnixHTTPServer returns unix_http_server configuration section
-func (c *Config) GetUnixHTTPServer() (*Entry, bool) {
-	entry, ok := c.entries["unix_http_server"]
+// the directory of the configuration file, the lock must be held
+func (c *Config) configFileDir() string {
+	if c.configFile == "" && c.configDir != "" {
+		return c.configDir
+	}
+	if isBundleFile(c.configFile) {
+		return filepath.Dir(c.bundle.main)
+	}
+	return sourceDir(c.configFile)
+}
 
+// get the entry of the section
+func (c *Config) getEntry(name string) (*Entry, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	entry, ok := c.entries[name]
 	return entry, ok
 }
 
+// GetUnixHTTPServer returns unix_http_server configuration section
+func (c *Config) GetUnixHTTPServer() (*Entry, bool) {
+	return c.getEntry("unix_http_server")
+}
+
 // GetZssld returns "zssld" configuration section
 func (c *Config) GetZssld() (*Entry, bool) {
-	entry, ok := c.entries["zssld"]
-	return entry, ok
+	return c.getEntry("zssld")
+}
+
+// GetChildLogDir returns the "childlogdir" of [zssld] where the AUTO log files
+// of the processes are created, the temporary directory by default
+func (c *Config) GetChildLogDir() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.childLogDir()
+}
+
+// the "childlogdir" of [zssld], the lock must be held
+func (c *Config) childLogDir() string {
+	if entry, ok := c.entries["zssld"]; ok {
+		if dir := entry.getStringExpression("childlogdir", "", false); dir != "" {
+			return dir
+		}
+	}
+	return os.TempDir()
+}
+
+// the "identifier" of [zssld] in the names of the AUTO log files, the lock
+// must be held
+func (c *Config) getIdentifier() string {
+	if entry, ok := c.entries["zssld"]; ok {
+		return entry.getString("identifier", "zssld", false)
+	}
+	return "zssld"
 }
 
 // GetInetHTTPServer returns inet_http_server configuration section
 func (c *Config) GetInetHTTPServer() (*Entry, bool) {
-	entry, ok := c.entries["inet_http_server"]
-	return entry, ok
+	return c.getEntry("inet_http_server")
 }
 
 // GetZsslctl returns "zsslctl" configuration section
 func (c *Config) GetZsslctl() (*Entry, bool) {
-	entry, ok := c.entries["zsslctl"]
-	return entry, ok
+	return c.getEntry("zsslctl")
 }
 
 // GetZsslServer
 func (c *Config) GetZsslServer() (*Entry, bool) {
-	entry, ok := c.entries["zssl-server"]
-	return entry, ok
+	return c.getEntry("zssl-server")
 }
 
-// GetEntries returns configuration entries by filter
+// EntryOrder reports whether entry a must be ordered before entry b
+type EntryOrder func(a *Entry, b *Entry) bool
+
+// ByPriority orders entries by the "priority" key (999 if missing), then by name
+func ByPriority(a *Entry, b *Entry) bool {
+	pa, pb := a.rawInt("priority", defaultPriority), b.rawInt("priority", defaultPriority)
+	if pa != pb {
+		return pa < pb
+	}
+	return a.Name < b.Name
+}
+
+// ByName orders entries by name
+func ByName(a *Entry, b *Entry) bool {
+	return a.Name < b.Name
+}
+
+// GetEntries returns configuration entries by filter, ordered by priority then name
 func (c *Config) GetEntries(filterFunc func(entry *Entry) bool) []*Entry {
+	return c.GetEntriesOrdered(filterFunc, ByPriority)
+}
+
+// GetEntriesOrdered returns configuration entries by filter in the given order
+func (c *Config) GetEntriesOrdered(filterFunc func(entry *Entry) bool, order EntryOrder) []*Entry {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.entriesOrdered(filterFunc, order)
+}
+
+// the entries by filter in the given order, the lock must be held
+func (c *Config) entriesOrdered(filterFunc func(entry *Entry) bool, order EntryOrder) []*Entry {
 	result := make([]*Entry, 0)
 	for _, entry := range c.entries {
 		if filterFunc(entry) {
 			result = append(result, entry)
 		}
 	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return order(result[i], result[j])
+	})
 	return result
 }
 
 // String converts configuration to the string
 func (c *Config) String() string {
 	buf := bytes.NewBuffer(make([]byte, 0))
-	for _, v := range c.entries {
+	all := c.GetEntriesOrdered(func(entry *Entry) bool {
+		return true
+	}, ByName)
+	for _, v := range all {
 		fmt.Fprintf(buf, "[%s]\n", v.Name)
 		fmt.Fprintf(buf, "%s\n", v.String())
 	}
 	return buf.String()
 }
 
-// GetPrograms returns configuration entries of all programs
+// GetPrograms returns configuration entries of all programs, ordered by priority then name
 func (c *Config) GetPrograms() []*Entry {
 	programs := c.GetEntries(func(entry *Entry) bool {
 		return entry.IsProgram()
@@ -122,7 +611,7 @@ func (c *Config) GetPrograms() []*Entry {
 	return programs
 }
 
-// GetEventListeners returns configuration entries of event listeners
+// GetEventListeners returns configuration entries of event listeners, ordered by priority then name
 func (c *Config) GetEventListeners() []*Entry {
 	eventListeners := c.GetEntries(func(entry *Entry) bool {
 		return entry.IsEventListener()
@@ -131,13 +620,44 @@ func (c *Config) GetEventListeners() []*Entry {
 	return eventListeners
 }
 
-// GetProgramNames returns slice with all program names
+// GetProgramsSorted returns configuration entries of all programs, ordered by
+// priority, then by the declaration order of their sections in the loaded files,
+// then by the process number, so the programs are started and stopped in a
+// deterministic order
+func (c *Config) GetProgramsSorted() []*Entry {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.sortProgram(c.entriesOrdered(func(entry *Entry) bool {
+		return entry.IsProgram()
+	}, ByPriority))
+}
+
+// sort the programs by priority, then by the declaration order of their
+// sections and the process number, the lock must be held
+func (c *Config) sortProgram(programs []*Entry) []*Entry {
+	order := func(entry *Entry) int {
+		if i, ok := c.sectionOrder[entry.section]; ok {
+			return i
+		}
+		return len(c.sectionOrder)
+	}
+	sort.SliceStable(programs, func(i, j int) bool {
+		a, b := programs[i], programs[j]
+		if pa, pb := a.rawInt("priority", defaultPriority), b.rawInt("priority", defaultPriority); pa != pb {
+			return pa < pb
+		}
+		if oa, ob := order(a), order(b); oa != ob {
+			return oa < ob
+		}
+		return a.rawInt("process_num", 0) < b.rawInt("process_num", 0)
+	})
+	return programs
+}
+
+// GetProgramNames returns slice with all program names, ordered like GetProgramsSorted
 func (c *Config) GetProgramNames() []string {
 	result := make([]string, 0)
-	programs := c.GetPrograms()
-
-	// programs = sortProgram(programs)
-	for _, entry := range programs {
+	for _, entry := range c.GetProgramsSorted() {
 		result = append(result, entry.GetProgramName())
 	}
 	return result
@@ -145,64 +665,445 @@ func (c *Config) GetProgramNames() []string {
 
 // GetProgram returns the program configuration entry or nil
 func (c *Config) GetProgram(name string) *Entry {
-	for _, entry := range c.entries {
-		if entry.IsProgram() && entry.GetProgramName() == name {
-			return entry
-		}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.programs[name]
+}
+
+// GetGroupPrograms returns the configuration entries of all program processes in the group
+func (c *Config) GetGroupPrograms(name string) []*Entry {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	members, ok := c.groups[name]
+	if !ok {
+		return make([]*Entry, 0)
 	}
-	return nil
+	return append(make([]*Entry, 0, len(members)), members...)
 }
 
-func (c *Config) getIncludeFiles(cfg *ini.Ini) []string {
+// return the include files of the [include] section of cfg and the directories
+// they are searched in, here is the directory of the file with the section
+func (c *Config) getIncludeFiles(cfg *ini.Ini, here string) ([]string, []string) {
 	result := make([]string, 0)
+	includeDirs := make([]string, 0)
 	if includeSection, err := cfg.GetSection("include"); err == nil {
 		key, err := includeSection.GetValue("files")
 		if err == nil {
-			env := NewStringExpression("here", c.GetConfigFileDir())
-			files := strings.Fields(key)
+			env := NewStringExpression("here", here)
+			files := splitByAny(key, listSeparators)
+			// the directory listings, read at most once per directory
+			dirs := make(map[string][]os.FileInfo)
 			for _, fRaw := range files {
-				dir := c.GetConfigFileDir()
 				f, err := env.Eval(fRaw)
 				if err != nil {
 					continue
 				}
-				if filepath.IsAbs(f) {
-					dir = filepath.Dir(f)
-				} else {
-					dir = filepath.Join(c.GetConfigFileDir(), filepath.Dir(f))
+				remote := isRemoteFile(f) || isRemoteFile(here) && !isAbsConfigPath(f)
+				if !remote {
+					f = joinConfigPath(here, f)
 				}
-				fileInfos, err := ioutil.ReadDir(dir)
-				if err == nil {
-					goPattern := toRegexp(filepath.Base(f))
-					for _, fileInfo := range fileInfos {
-						if matched, err := regexp.MatchString(goPattern, fileInfo.Name()); matched && err == nil {
-							result = append(result, filepath.Join(dir, fileInfo.Name()))
+				switch {
+				case remote:
+					// the remote include files are not globbed
+					f, err = resolveRemoteFile(here, f)
+					if err == nil {
+						result = append(result, f)
+					}
+				case strings.Contains(f, "**"):
+					var matched, walked []string
+					matched, walked, err = globRecursive(f)
+					result = append(result, matched...)
+					includeDirs = append(includeDirs, walked...)
+				default:
+					dir := filepath.Dir(f)
+					fileInfos, ok := dirs[dir]
+					if !ok {
+						fileInfos, err = ioutil.ReadDir(dir)
+						dirs[dir] = fileInfos
+						includeDirs = append(includeDirs, dir)
+					}
+					if err != nil {
+						continue
+					}
+					// the whole file names are matched
+					pattern := filepath.Base(f)
+					if _, err = filepath.Match(pattern, ""); err == nil {
+						for _, fileInfo := range fileInfos {
+							if ok, _ := filepath.Match(pattern, fileInfo.Name()); ok {
+								result = append(result, filepath.Join(dir, fileInfo.Name()))
+							}
 						}
 					}
 				}
+				if err != nil {
+					c.loading.log(ErrorLevel, "invalid include file pattern", Fields{
+						log.ErrorKey: err,
+						"files":      fRaw,
+					})
+				}
 
 			}
 		}
 	}
-	return result
+	return result, includeDirs
 }
 
-func (c *Config) parse(cfg *ini.Ini) []string {
+// find the files matching the pattern with "**" matching any number of
+// directories, the walked directories are returned also
+func globRecursive(pattern string) ([]string, []string, error) {
+	parts := strings.Split(filepath.ToSlash(pattern), "/")
+	// the directory before the first part with wildcards
+	n := 0
+	for n < len(parts)-1 && !strings.ContainsAny(parts[n], "*?[\\") {
+		n++
+	}
+	root := filepath.FromSlash(strings.Join(parts[:n], "/"))
+	if n == 0 {
+		root = "."
+	} else if root == "" {
+		root = string(filepath.Separator)
+	}
+	for _, part := range parts[n:] {
+		if _, err := filepath.Match(part, ""); err != nil {
+			return nil, nil, err
+		}
+	}
+	files := make([]string, 0)
+	dirs := make([]string, 0)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// skip the unreadable directories like the single level patterns
+			return nil
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err == nil && matchGlobParts(parts[n:], strings.Split(filepath.ToSlash(rel), "/")) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, dirs, err
+}
+
+// match the path parts with the pattern parts, "**" matches any number of parts
+func matchGlobParts(patterns []string, parts []string) bool {
+	if len(patterns) == 0 {
+		return len(parts) == 0
+	}
+	if patterns[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchGlobParts(patterns[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := filepath.Match(patterns[0], parts[0])
+	return ok && matchGlobParts(patterns[1:], parts[1:])
+}
+
+// parse the merged configuration, locations are the locations of the keys in
+// the loaded files
+func (c *Config) parse(cfg *ini.Ini, locations map[string]map[string]keyLocation) []string {
+	oldEntries := c.entries
+	c.entries = make(map[string]*Entry)
+	c.problems = make([]ValidationError, 0)
+	c.locations = locations
+	c.applyTemplates(cfg)
+	c.applyManifests(cfg)
 	c.setProgramDefaultParams(cfg)
-	loadedPrograms := c.parseProgram(cfg)
+	loadedPrograms, instances := c.parseProgram(cfg)
 
 	// parse non-group, non-program and non-eventlistener sections
 	for _, section := range cfg.Sections() {
 		// 过滤组，程序，和监听
-		if !strings.HasPrefix(section.Name, "group:") && !strings.HasPrefix(section.Name, "program:") && !strings.HasPrefix(section.Name, "eventlistener:") {
-			entry := c.createEntry(section.Name, c.GetConfigFileDir())
+		if !strings.HasPrefix(section.Name, "group:") && !strings.HasPrefix(section.Name, "program:") && !strings.HasPrefix(section.Name, "eventlistener:") && !strings.HasPrefix(section.Name, "template:") {
+			entry := c.createEntry(section.Name, c.configFileDir())
 			c.entries[section.Name] = entry
 			entry.parse(section)
+			if isSupervisordSection(section.Name) {
+				c.addProblem(section.Name, "", "the legacy supervisord section is loaded only in the supervisord compatibility mode")
+			}
+		}
+	}
+	groups := c.resolveGroups(cfg, instances)
+	childLogDir, identifier := c.childLogDir(), c.getIdentifier()
+	for _, entry := range c.entries {
+		if entry.IsProgram() || entry.IsEventListener() {
+			entry.childLogDir, entry.identifier = childLogDir, identifier
+		}
+	}
+	added, changed, removed := c.keepUnchangedEntries(oldEntries)
+	if len(oldEntries) > 0 {
+		c.loading.log(InfoLevel, "configuration entries reloaded", Fields{
+			"added":   len(added),
+			"changed": len(changed),
+			"removed": len(removed),
+		})
+	}
+	c.buildIndexes(groups)
+	for _, entry := range c.entries {
+		entry.setLocations(c.locateKeys(cfg, entry))
+	}
+	c.checkDirectories()
+	// the new entries are warned once per section
+	warned := make(map[string]bool)
+	for name, entry := range c.entries {
+		if oldEntries[name] != entry && !warned[entry.section] {
+			warned[entry.section] = true
+			entry.warnKeys(c.loading)
 		}
 	}
+	sort.SliceStable(loadedPrograms, func(i, j int) bool {
+		return ByPriority(c.entries[loadedPrograms[i]], c.entries[loadedPrograms[j]])
+	})
 	return loadedPrograms
 }
 
+// check the "directory" of the programs and the event listeners exists, the
+// missing directory with "create_dirs=true" is left to CreateDirs. The
+// problems are reported at load time rather than when the process is spawned
+func (c *Config) checkDirectories() {
+	for _, entry := range c.entries {
+		if !entry.IsProgram() && !entry.IsEventListener() {
+			continue
+		}
+		dir := entry.getStringExpression("directory", "", false)
+		if dir == "" {
+			continue
+		}
+		fileInfo, err := os.Stat(dir)
+		switch {
+		case os.IsNotExist(err) && entry.rawBool("create_dirs", false):
+		case os.IsNotExist(err):
+			c.addProblem(entry.section, "directory", fmt.Sprintf("directory %s doesn't exist", dir))
+		case err != nil:
+			c.addProblem(entry.section, "directory", err.Error())
+		case !fileInfo.IsDir():
+			c.addProblem(entry.section, "directory", fmt.Sprintf("%s is not a directory", dir))
+		}
+	}
+}
+
+// CreateDirs creates the missing "directory" of the programs and the event
+// listeners with "create_dirs=true". It is called once the loaded
+// configuration is accepted, the loading itself never creates directories so
+// a dry run like Check or a rejected strict load leaves the file system as
+// it is. The directories which can't be created are reported in the returned
+// ValidationErrors
+func (c *Config) CreateDirs() error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	var errs ValidationErrors
+	created := make(map[string]bool)
+	for _, entry := range c.entriesOrdered(func(entry *Entry) bool {
+		return entry.IsProgram() || entry.IsEventListener()
+	}, ByName) {
+		dir := entry.getStringExpression("directory", "", false)
+		if dir == "" || created[dir] || !entry.rawBool("create_dirs", false) {
+			continue
+		}
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			file, line := entry.Source("directory")
+			errs = append(errs, ValidationError{Section: entry.section, Key: "directory", Msg: err.Error(), File: file, Line: line})
+			continue
+		}
+		created[dir] = true
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// replace the parsed entries which are equal to the entries in oldEntries with
+// the old ones, and return the names of the added, changed and removed entries
+func (c *Config) keepUnchangedEntries(oldEntries map[string]*Entry) (added []string, changed []string, removed []string) {
+	for name, entry := range c.entries {
+		oldEntry, ok := oldEntries[name]
+		if !ok {
+			added = append(added, entry.Name)
+		} else if oldEntry.equals(entry) {
+			c.entries[name] = oldEntry
+		} else {
+			changed = append(changed, entry.Name)
+		}
+	}
+	for name, oldEntry := range oldEntries {
+		if _, ok := c.entries[name]; !ok {
+			removed = append(removed, oldEntry.Name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return
+}
+
+// rebuild the program and group lookup indexes from the parsed entries.
+//
+// groups maps the group name to the parsed entries of its member processes,
+// which are replaced by the kept unchanged entries
+func (c *Config) buildIndexes(groups map[string][]*Entry) {
+	c.programs = make(map[string]*Entry)
+	c.groups = make(map[string][]*Entry)
+	for _, entry := range c.entries {
+		if entry.IsProgram() {
+			c.programs[entry.GetProgramName()] = entry
+		}
+	}
+	for name, members := range groups {
+		entries := make([]*Entry, 0, len(members))
+		for _, member := range members {
+			entries = append(entries, c.programs[member.GetProgramName()])
+		}
+		c.groups[name] = entries
+	}
+}
+
+// resolve the member processes of the [group:x] sections and set the group of
+// the processes to the first group listing their program.
+//
+// A member of "programs" is a program, or a group if there is no such program
+// or it has the "group:" prefix. The missing members and the groups including
+// themselves are recorded as problems.
+//
+// instances maps the program section name to the entries of its processes
+func (c *Config) resolveGroups(cfg *ini.Ini, instances map[string][]*Entry) map[string][]*Entry {
+	sections := make(map[string]*ini.Section)
+	names := make([]string, 0)
+	for _, section := range cfg.Sections() {
+		if strings.HasPrefix(section.Name, "group:") {
+			name := section.Name[len("group:"):]
+			sections[name] = section
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := make(map[string][]*Entry)
+	resolving := make(map[string]bool)
+	var resolve func(name string) []*Entry
+	resolve = func(name string) []*Entry {
+		if members, ok := result[name]; ok {
+			return members
+		}
+		resolving[name] = true
+		section := sections[name]
+		members := make([]*Entry, 0)
+		for _, member := range splitByAny(section.GetValueWithDefault("programs", ""), listSeparators) {
+			group := strings.TrimPrefix(member, "group:")
+			if processes, ok := instances[member]; ok && group == member {
+				for _, entry := range processes {
+					if entry.Group == "" {
+						entry.setGroup(name)
+					}
+				}
+				members = append(members, processes...)
+				continue
+			}
+			if _, ok := sections[group]; !ok {
+				c.addProblem(section.Name, "programs", fmt.Sprintf("no program or group %s", member))
+				continue
+			}
+			if resolving[group] {
+				c.addProblem(section.Name, "programs", fmt.Sprintf("group %s includes itself", group))
+				continue
+			}
+			members = append(members, resolve(group)...)
+		}
+		resolving[name] = false
+
+		// the processes included more than once are kept at their first position
+		unique := make([]*Entry, 0, len(members))
+		seen := make(map[*Entry]bool)
+		for _, entry := range members {
+			if !seen[entry] {
+				seen[entry] = true
+				unique = append(unique, entry)
+			}
+		}
+		result[name] = unique
+		return unique
+	}
+	for _, name := range names {
+		resolve(name)
+	}
+	return result
+}
+
+// find the locations of the keys of the entry in its section, then in the
+// templates it uses and in [program-default] which the keys are copied from
+func (c *Config) locateKeys(cfg *ini.Ini, entry *Entry) map[string]keyLocation {
+	sections := []string{entry.section}
+	used := make(map[string]bool)
+	keyValues := entry.copyKeyValues()
+	for name := keyValues["use_template"]; name != "" && !used[name]; {
+		used[name] = true
+		sections = append(sections, "template:"+name)
+		template, err := cfg.GetSection("template:" + name)
+		if err != nil {
+			break
+		}
+		name = strings.TrimSpace(template.GetValueWithDefault("use_template", ""))
+	}
+	sections = append(sections, "program-default")
+
+	result := make(map[string]keyLocation)
+	for key := range keyValues {
+		for _, section := range sections {
+			if location, ok := c.locations[section][key]; ok {
+				result[key] = location
+				break
+			}
+		}
+	}
+	if location, ok := c.locations[entry.section][""]; ok {
+		result[""] = location
+	}
+	return result
+}
+
+// copy the keys of the [template:x] sections to the program and event listener
+// sections with "use_template=x". The keys of the section override the keys of
+// the template, and a template can use another template
+func (c *Config) applyTemplates(cfg *ini.Ini) {
+	for _, section := range cfg.Sections() {
+		if ok, _ := c.isProgramOrEventListener(section); !ok || !section.HasKey("use_template") {
+			continue
+		}
+		used := make(map[string]bool)
+		for name := section.GetValueWithDefault("use_template", ""); name != ""; {
+			name = strings.TrimSpace(name)
+			if used[name] {
+				c.addProblem(section.Name, "use_template", fmt.Sprintf("template %s is used recursively", name))
+				break
+			}
+			used[name] = true
+			template, err := cfg.GetSection("template:" + name)
+			if err != nil {
+				c.addProblem(section.Name, "use_template", fmt.Sprintf("no template %s", name))
+				break
+			}
+			for _, key := range template.Keys() {
+				if key.Name() != "use_template" && !section.HasKey(key.Name()) {
+					section.Add(key.Name(), key.ValueWithDefault(""))
+				}
+			}
+			name = template.GetValueWithDefault("use_template", "")
+		}
+	}
+}
+
 // set the default parameters of programs
 func (c *Config) setProgramDefaultParams(cfg *ini.Ini) {
 	programDefaultSection, err := cfg.GetSection("program-default")
@@ -236,9 +1137,10 @@ func (c *Config) isProgramOrEventListener(section *ini.Section) (bool, string) {
 
 // parse the sections starts with "program:" prefix.
 //
-// Return all the parsed program names in the ini
-func (c *Config) parseProgram(cfg *ini.Ini) []string {
+// Return all the parsed program names in the ini and the process entries of every program section
+func (c *Config) parseProgram(cfg *ini.Ini) ([]string, map[string][]*Entry) {
 	loadedPrograms := make([]string, 0)
+	instances := make(map[string][]*Entry)
 	for _, section := range cfg.Sections() {
 		programOrEventListener, prefix := c.isProgramOrEventListener(section)
 
@@ -250,13 +1152,34 @@ func (c *Config) parseProgram(cfg *ini.Ini) []string {
 			if err != nil {
 				numProcs = 1
 			}
+			if value, err := section.GetValue("condition"); err == nil {
+				met, err := conditionsMet(value)
+				if err != nil {
+					c.addProblem(section.Name, "condition", err.Error())
+				}
+				if !met {
+					c.loading.log(InfoLevel, "the program is skipped as its condition is not met", Fields{"program": programName, "condition": value})
+					// the groups skip the program also
+					if prefix == "program:" {
+						instances[programName] = make([]*Entry, 0)
+					}
+					continue
+				}
+			}
+			// the processes are numbered from numprocs_start, or from 1 if
+			// it is not set
+			numProcsStart, err := section.GetInt("numprocs_start")
+			if err != nil {
+				numProcsStart = 1
+			}
 			procName, err := section.GetValue("process_name")
 			if numProcs > 1 {
 				if err != nil || strings.Index(procName, "%(process_num)") == -1 {
-					log.WithFields(log.Fields{
+					c.loading.log(ErrorLevel, "no process_num in process name", Fields{
 						"numprocs":     numProcs,
 						"process_name": procName,
-					}).Error("no process_num in process name")
+					})
+					c.addProblem(section.Name, "process_name", "no %(process_num) in process name while numprocs is greater than 1")
 				}
 			}
 			originalProcName := programName
@@ -266,107 +1189,93 @@ func (c *Config) parseProgram(cfg *ini.Ini) []string {
 
 			originalCmd := section.GetValueWithDefault("command", "")
 
-			for i := 1; i <= numProcs; i++ {
+			for i := numProcsStart; i < numProcsStart+numProcs; i++ {
 				envs := NewStringExpression("program_name", programName,
 					"process_num", fmt.Sprintf("%d", i),
-					"here", c.GetConfigFileDir())
+					"here", c.configFileDir())
 				envValue, err := section.GetValue("environment")
 				if err == nil {
-					for k, v := range *parseEnv(envValue) {
+					programEnvs, err := ParseEnvironment(envValue)
+					if err != nil {
+						c.loading.log(ErrorLevel, "invalid environment", Fields{
+							log.ErrorKey: err,
+							"program":    programName,
+						})
+						c.addProblem(section.Name, "environment", err.Error())
+					}
+					for k, v := range programEnvs {
 						envs.Add(fmt.Sprintf("ENV_%s", k), v)
 					}
 				}
 				cmd, err := envs.Eval(originalCmd)
 				if err != nil {
-					log.WithFields(log.Fields{
+					c.loading.log(ErrorLevel, "get envs failed", Fields{
 						log.ErrorKey: err,
 						"program":    programName,
-					}).Error("get envs failed")
+					})
+					c.addProblem(section.Name, "command", err.Error())
 					continue
 				}
-				section.Add("command", cmd)
 
 				procName, err := envs.Eval(originalProcName)
 				if err != nil {
-					log.WithFields(log.Fields{
+					c.loading.log(ErrorLevel, "get envs failed", Fields{
 						log.ErrorKey: err,
 						"program":    programName,
-					}).Error("get envs failed")
+					})
+					c.addProblem(section.Name, "process_name", err.Error())
 					continue
 				}
 
-				section.Add("process_name", procName)
-				section.Add("numprocs_start", fmt.Sprintf("%d", i-1))
-				section.Add("process_num", fmt.Sprintf("%d", i))
-				entry := c.createEntry(procName, c.GetConfigFileDir())
-				entry.parse(section)
+				entry := c.createEntry(procName, c.configFileDir())
+				entry.parseProcess(section, map[string]string{
+					"command":        cmd,
+					"process_name":   procName,
+					"numprocs_start": fmt.Sprintf("%d", numProcsStart),
+					"process_num":    fmt.Sprintf("%d", i),
+				})
 				entry.Name = prefix + procName
 				loadedPrograms = append(loadedPrograms, procName)
+				if prefix == "program:" {
+					instances[programName] = append(instances[programName], entry)
+				}
 			}
 		}
 	}
-	return loadedPrograms
+	return loadedPrograms, instances
 }
 
-func parseEnv(s string) *map[string]string {
-	result := make(map[string]string)
-	start := 0
-	n := len(s)
-	var i int
-	for {
-		// find the '='
-		for i = start; i < n && s[i] != '='; {
-			i++
-		}
-		key := s[start:i]
-		start = i + 1
-		if s[start] == '"' {
-			for i = start + 1; i < n && s[i] != '"'; {
-				i++
-			}
-			if i < n {
-				result[strings.TrimSpace(key)] = strings.TrimSpace(s[start+1 : i])
-			}
-			if i+1 < n && s[i+1] == ',' {
-				start = i + 2
-			} else {
-				break
-			}
-		} else {
-			for i = start; i < n && s[i] != ','; {
-				i++
-			}
-			if i < n {
-				result[strings.TrimSpace(key)] = strings.TrimSpace(s[start:i])
-				start = i + 1
-			} else {
-				result[strings.TrimSpace(key)] = strings.TrimSpace(s[start:])
-				break
-			}
+// the env files of the "envFiles" value
+func envFilePaths(s string) []string {
+	result := make([]string, 0)
+	for _, envFilePath := range strings.Split(s, ",") {
+		if envFilePath = strings.TrimSpace(envFilePath); envFilePath != "" {
+			result = append(result, envFilePath)
 		}
 	}
-
-	return &result
+	return result
 }
 
-func parseEnvFiles(s string) *map[string]string {
+// parse the env files of the "envFiles" value s of the entry, the files which
+// can't be read or parsed are logged and skipped
+func (c *Entry) parseEnvFiles(s string) *map[string]string {
 	result := make(map[string]string)
-	for _, envFilePath := range strings.Split(s, ",") {
-		envFilePath = strings.TrimSpace(envFilePath)
+	for _, envFilePath := range envFilePaths(s) {
 		f, err := os.Open(envFilePath)
 		if err != nil {
-			log.WithFields(log.Fields{
+			c.log(ErrorLevel, "Read file failed: "+envFilePath, Fields{
 				log.ErrorKey: err,
 				"file":       envFilePath,
-			}).Error("Read file failed: " + envFilePath)
+			})
 			continue
 		}
 		r, err := envparse.Parse(f)
+		f.Close()
 		if err != nil {
-			log.WithFields(log.Fields{
+			c.log(ErrorLevel, "Parse env file failed: "+envFilePath, Fields{
 				log.ErrorKey: err,
 				"file":       envFilePath,
-			}).Error("Parse env file failed: " + envFilePath)
+			})
 			continue
 		}
 		for k, v := range r {
@@ -375,13 +1284,3 @@ func parseEnvFiles(s string) *map[string]string {
 	}
 	return &result
 }
-
-// convert supervisor file pattern to the go regrexp
-func toRegexp(pattern string) string {
-	tmp := strings.Split(pattern, ".")
-	for i, t := range tmp {
-		s := strings.Replace(t, "*", ".*", -1)
-		tmp[i] = strings.Replace(s, "?", ".", -1)
-	}
-	return strings.Join(tmp, "\\.")
-}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"sync"
+)
+
+// AccessHook is notified of the keys read from the entries of the
+// configuration, e.g. to report the configured keys which are never consumed:
+//
+//	type usage map[string]bool
+//
+//	func (u usage) OnGet(section string, key string, value string) {
+//		u[section+"."+key] = true
+//	}
+//
+// OnGet is called with the section the entry is parsed from, e.g.
+// "program:web" for the process "program:web_1", and the value as it is
+// configured, so the ENC[...] values are not decrypted. It is called only for
+// the keys set in the entry, from the goroutines reading the configuration,
+// so it must be safe for concurrent use. The reads of the configuration
+// itself, e.g. sorting the programs by "priority" or exporting the entries,
+// are not notified, and the hook is never called while the configuration is
+// locked
+type AccessHook interface {
+	OnGet(section string, key string, value string)
+}
+
+// the access hook shared by the entries of a configuration
+type accessHooks struct {
+	sync.RWMutex
+	hook AccessHook
+}
+
+// notify the hook of the key read from the section
+func (a *accessHooks) notify(section string, key string, value string) {
+	a.RLock()
+	hook := a.hook
+	a.RUnlock()
+	if hook != nil {
+		hook.OnGet(section, key, value)
+	}
+}
+
+// SetAccessHook sets the hook notified of the keys read from the entries of
+// the configuration, including the entries loaded before, nil removes the hook
+func (c *Config) SetAccessHook(hook AccessHook) {
+	c.access.Lock()
+	defer c.access.Unlock()
+	c.access.hook = hook
+}
+
+// get the value of the key without notifying the access hook
+func (c *Entry) rawLookup(key string) (string, bool) {
+	c.keyLock.RLock()
+	defer c.keyLock.RUnlock()
+	value, ok := c.keyValues[key]
+	return value, ok
+}
+
+// get the value of the key, the access hook is notified only if notify is true
+func (c *Entry) find(key string, notify bool) (string, bool) {
+	if notify {
+		return c.lookup(key)
+	}
+	return c.rawLookup(key)
+}
+
+// get the int value of the key without notifying the access hook
+func (c *Entry) rawInt(key string, defValue int) int {
+	if value, ok := c.rawLookup(key); ok {
+		return toInt(value, 1, defValue)
+	}
+	return defValue
+}
+
+// get the bool value of the key without notifying the access hook, defValue
+// is returned if the value is invalid
+func (c *Entry) rawBool(key string, defValue bool) bool {
+	if value, ok := c.rawLookup(key); ok {
+		if b, err := parseBool(value); err == nil {
+			return b
+		}
+	}
+	return defValue
+}
+
+// get the value of the key and notify the access hook of the configuration
+// if the key is set
+func (c *Entry) lookup(key string) (string, bool) {
+	value, ok := c.rawLookup(key)
+	if ok && c.access != nil {
+		section := c.section
+		if section == "" {
+			section = c.Name
+		}
+		c.access.notify(section, key, value)
+	}
+	return value, ok
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EntryBuilder builds a configuration section in Go code, the built entries
+// are loaded by NewConfigFromEntries:
+//
+//	c, err := config.NewConfigFromEntries(
+//		config.NewSectionEntry("zssld").Set("childlogdir", "/var/log/app").Build(),
+//		config.NewProgramEntry("worker").Command("/usr/bin/worker").NumProcs(3).Build())
+type EntryBuilder struct {
+	name      string
+	keyValues map[string]string
+}
+
+// NewSectionEntry creates the builder of the section with the full name, e.g.
+// "zssld", "inet_http_server" or "program:web"
+func NewSectionEntry(name string) *EntryBuilder {
+	return &EntryBuilder{name: name, keyValues: make(map[string]string)}
+}
+
+// NewProgramEntry creates the builder of the [program:name] section
+func NewProgramEntry(name string) *EntryBuilder {
+	return NewSectionEntry("program:" + name)
+}
+
+// NewEventListenerEntry creates the builder of the [eventlistener:name] section
+func NewEventListenerEntry(name string) *EntryBuilder {
+	return NewSectionEntry("eventlistener:" + name)
+}
+
+// NewGroupEntry creates the builder of the [group:name] section with the
+// member programs
+func NewGroupEntry(name string, programs ...string) *EntryBuilder {
+	return NewSectionEntry("group:"+name).Set("programs", strings.Join(programs, ","))
+}
+
+// Set sets the value of the key, the value is taken as it is written in the
+// configuration file, so "%(here)s" and the other expressions are evaluated
+func (b *EntryBuilder) Set(key string, value string) *EntryBuilder {
+	b.keyValues[key] = strings.TrimSpace(value)
+	return b
+}
+
+// Command sets the "command" key
+func (b *EntryBuilder) Command(command string) *EntryBuilder {
+	return b.Set("command", command)
+}
+
+// ProcessName sets the "process_name" key
+func (b *EntryBuilder) ProcessName(processName string) *EntryBuilder {
+	return b.Set("process_name", processName)
+}
+
+// NumProcs sets the "numprocs" key
+func (b *EntryBuilder) NumProcs(n int) *EntryBuilder {
+	return b.Set("numprocs", strconv.Itoa(n))
+}
+
+// NumProcsStart sets the "numprocs_start" key, the first process number of
+// the numprocs processes
+func (b *EntryBuilder) NumProcsStart(n int) *EntryBuilder {
+	return b.Set("numprocs_start", strconv.Itoa(n))
+}
+
+// Priority sets the "priority" key
+func (b *EntryBuilder) Priority(priority int) *EntryBuilder {
+	return b.Set("priority", strconv.Itoa(priority))
+}
+
+// AutoStart sets the "autostart" key
+func (b *EntryBuilder) AutoStart(autoStart bool) *EntryBuilder {
+	return b.Set("autostart", strconv.FormatBool(autoStart))
+}
+
+// AutoRestart sets the "autorestart" key to one of AutoRestartAlways,
+// AutoRestartNever and AutoRestartUnexpected
+func (b *EntryBuilder) AutoRestart(autoRestart string) *EntryBuilder {
+	return b.Set("autorestart", autoRestart)
+}
+
+// StartSecs sets the "startsecs" key
+func (b *EntryBuilder) StartSecs(d time.Duration) *EntryBuilder {
+	return b.Set("startsecs", d.String())
+}
+
+// StopSignal sets the "stopsignal" key
+func (b *EntryBuilder) StopSignal(signal string) *EntryBuilder {
+	return b.Set("stopsignal", signal)
+}
+
+// StopWaitSecs sets the "stopwaitsecs" key
+func (b *EntryBuilder) StopWaitSecs(d time.Duration) *EntryBuilder {
+	return b.Set("stopwaitsecs", d.String())
+}
+
+// Directory sets the "directory" key
+func (b *EntryBuilder) Directory(dir string) *EntryBuilder {
+	return b.Set("directory", dir)
+}
+
+// CreateDirs sets the "create_dirs" key, the "directory" is created by
+// Config.CreateDirs if it doesn't exist
+func (b *EntryBuilder) CreateDirs(create bool) *EntryBuilder {
+	return b.Set("create_dirs", strconv.FormatBool(create))
+}
+
+// User sets the "user" key
+func (b *EntryBuilder) User(user string) *EntryBuilder {
+	return b.Set("user", user)
+}
+
+// Environment sets the "environment" key, the values are quoted so they can
+// contain any char
+func (b *EntryBuilder) Environment(env map[string]string) *EntryBuilder {
+	return b.Set("environment", formatEnvironment(env))
+}
+
+// DependsOn sets the "depends_on" key
+func (b *EntryBuilder) DependsOn(programs ...string) *EntryBuilder {
+	return b.Set("depends_on", strings.Join(programs, ","))
+}
+
+// RedirectStderr sets the "redirect_stderr" key
+func (b *EntryBuilder) RedirectStderr(redirect bool) *EntryBuilder {
+	return b.Set("redirect_stderr", strconv.FormatBool(redirect))
+}
+
+// StdoutLogfile sets the "stdout_logfile" key
+func (b *EntryBuilder) StdoutLogfile(logfile string) *EntryBuilder {
+	return b.Set("stdout_logfile", logfile)
+}
+
+// StderrLogfile sets the "stderr_logfile" key
+func (b *EntryBuilder) StderrLogfile(logfile string) *EntryBuilder {
+	return b.Set("stderr_logfile", logfile)
+}
+
+// Schedule sets the "schedule" cron expression, see Entry.GetCron
+func (b *EntryBuilder) Schedule(expr string) *EntryBuilder {
+	return b.Set("schedule", expr)
+}
+
+// Condition sets the "condition" key, the program is skipped if the
+// conditions are not met, see parseConditions
+func (b *EntryBuilder) Condition(condition string) *EntryBuilder {
+	return b.Set("condition", condition)
+}
+
+// UseTemplate sets the "use_template" key
+func (b *EntryBuilder) UseTemplate(template string) *EntryBuilder {
+	return b.Set("use_template", template)
+}
+
+// Build returns the entry of the section, the entry is parsed like the
+// sections in the files when loaded by NewConfigFromEntries
+func (b *EntryBuilder) Build() *Entry {
+	entry := NewEntry("")
+	entry.Name = b.name
+	entry.section = b.name
+	for key, value := range b.keyValues {
+		entry.keyValues[key] = value
+	}
+	return entry
+}
+
+// NewConfigFromEntries creates and loads the Config from the entries built by
+// EntryBuilder without any configuration file. The entries are handled the
+// same way as the sections of a file, e.g. the numprocs programs are expanded
+// and the templates and [program-default] are applied, and they are declared
+// in the order of entries. The returned Config is not nil if the error is
+// returned by the strict mode validation
+func NewConfigFromEntries(entries ...*Entry) (*Config, error) {
+	c := NewConfig("")
+	c.built = entries
+	_, err := c.Load()
+	return c, err
+}
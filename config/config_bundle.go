@@ -0,0 +1,235 @@
+package config
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// the main configuration files searched in the root of a bundle, in order
+var bundleMainFiles = []string{"zssld.conf", "zssld.ini", "zssld.yaml", "zssld.yml", "zssld.json"}
+
+// check if the configuration file is a bundle of the configuration files,
+// a ".tar.gz", ".tgz", ".tar" or ".zip" archive
+func isBundleFile(file string) bool {
+	lower := strings.ToLower(file)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// the path the bundle is loaded from, it is a link to the directory of the
+// loaded extraction so "%(here)s" is the same for every loading of the bundle
+// and the entries of the unchanged programs are kept on reload
+func bundleDir(file string) string {
+	hash := sha256.Sum256([]byte(file))
+	return filepath.Join(os.TempDir(), "zssld-bundle-"+hex.EncodeToString(hash[:8]))
+}
+
+// the bundle configuration file extracted to dir, main is the main
+// configuration file under the bundleDir link and hash is the hash of the bundle
+type extractedBundle struct {
+	dir  string
+	main string
+	hash [sha256.Size]byte
+}
+
+// extract the bundle configuration file if it is changed since the loaded
+// extraction, the main configuration file of the bundle is loaded as the
+// configuration file and "%(here)s" is the bundleDir link to the extraction.
+// The new and the loaded extractions are returned, they are the same if the
+// bundle is not changed.
+//
+// The bundle is extracted to a new directory and the link is switched to it
+// atomically. The link is switched back by releaseBundle if the configuration
+// parsed from the new extraction is not accepted, so a failed loading never
+// leaves the link at the files it failed with
+func (c *Config) extractBundle() (extractedBundle, extractedBundle, error) {
+	c.lock.RLock()
+	loaded := c.bundle
+	c.lock.RUnlock()
+	file := absConfigPath(c.configFile)
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return loaded, loaded, fmt.Errorf("%s: %w", file, err)
+	}
+	hash := sha256.Sum256(b)
+	if loaded.main != "" && loaded.hash == hash {
+		if _, err := os.Stat(loaded.main); err == nil {
+			return loaded, loaded, nil
+		}
+	}
+	link := bundleDir(file)
+	dir, err := os.MkdirTemp(filepath.Dir(link), filepath.Base(link)+"-")
+	if err != nil {
+		return loaded, loaded, err
+	}
+	if err = unpackBundle(file, b, dir); err == nil {
+		var main string
+		if main, err = findBundleMain(dir); err == nil {
+			if err = linkBundle(link, dir); err == nil {
+				return extractedBundle{dir: dir, main: filepath.Join(link, main), hash: hash}, loaded, nil
+			}
+		}
+	}
+	os.RemoveAll(dir)
+	return loaded, loaded, fmt.Errorf("%s: %w", file, err)
+}
+
+// point the link to the extraction directory dir, the link is replaced by a
+// rename so it always points to a complete extraction
+func linkBundle(link string, dir string) error {
+	tmp := dir + ".link"
+	os.Remove(tmp)
+	if err := os.Symlink(dir, tmp); err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(link); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		// the directory left by an earlier version extracting to the path itself
+		os.RemoveAll(link)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// switch the link back to the loaded extraction and remove the new one if the
+// new one is not accepted. The replaced extractions are not removed, the
+// running processes may still use them as their working directory
+func (c *Config) releaseBundle(bundle extractedBundle, loaded extractedBundle, accepted bool) {
+	if bundle.dir == loaded.dir || accepted {
+		return
+	}
+	link := bundleDir(absConfigPath(c.configFile))
+	if loaded.dir != "" {
+		linkBundle(link, loaded.dir)
+	} else {
+		os.Remove(link)
+	}
+	os.RemoveAll(bundle.dir)
+}
+
+// find the main configuration file in the root of the extracted bundle or in
+// its only top directory, the path relative to dir is returned
+func findBundleMain(dir string) (string, error) {
+	for _, root := range []string{"", "*"} {
+		for _, name := range bundleMainFiles {
+			matches, _ := filepath.Glob(filepath.Join(dir, root, name))
+			if len(matches) == 1 {
+				return filepath.Rel(dir, matches[0])
+			}
+		}
+	}
+	return "", fmt.Errorf("no %s in the bundle", strings.Join(bundleMainFiles, ", "))
+}
+
+// unpack the bundle b to dir, the regular files and the directories are
+// unpacked and the other entries like the links are skipped
+func unpackBundle(file string, b []byte, dir string) error {
+	if strings.HasSuffix(strings.ToLower(file), ".zip") {
+		return unpackZip(b, dir)
+	}
+	var r io.Reader = bytes.NewReader(b)
+	if !strings.HasSuffix(strings.ToLower(file), ".tar") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = unpackBundleDir(dir, header.Name)
+		case tar.TypeReg:
+			err = unpackBundleFile(dir, header.Name, header.FileInfo().Mode(), tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unpack the zip bundle b to dir
+func unpackZip(b []byte, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			err = unpackBundleDir(dir, f.Name)
+		} else if f.Mode().IsRegular() {
+			var rc io.ReadCloser
+			if rc, err = f.Open(); err == nil {
+				err = unpackBundleFile(dir, f.Name, f.Mode(), rc)
+				rc.Close()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the path of the bundle entry in dir, the entries outside of dir are rejected
+func bundleEntryPath(dir string, name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid bundle entry %s", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+// create the directory entry of the bundle in dir
+func unpackBundleDir(dir string, name string) error {
+	p, err := bundleEntryPath(dir, name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, 0755)
+}
+
+// write the file entry of the bundle read from r in dir
+func unpackBundleFile(dir string, name string, mode os.FileMode, r io.Reader) error {
+	p, err := bundleEntryPath(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Report the result of checking a configuration file with Check
+type Report struct {
+	// the loaded configuration files in the merging order
+	Files []string
+	// the program processes in the start order
+	Programs []string
+	// the problems found in the configuration
+	Problems []ValidationError
+	// the effective configuration after applying the includes, templates,
+	// defaults and numprocs expansion, with the "%(var)s" expressions evaluated
+	Effective string
+}
+
+// OK returns true if no problem is found
+func (r Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// WriteTo writes the effective configuration followed by the problems and the
+// result of the check
+func (r Report) WriteTo(w io.Writer) (int64, error) {
+	buf := bytes.NewBufferString(r.Effective)
+	for _, problem := range r.Problems {
+		fmt.Fprintf(buf, "error: %s\n", problem.Error())
+	}
+	for _, file := range r.Files {
+		fmt.Fprintf(buf, "configuration file %s loaded\n", file)
+	}
+	if r.OK() {
+		fmt.Fprintf(buf, "configuration test is successful, %d programs\n", len(r.Programs))
+	} else {
+		fmt.Fprintf(buf, "configuration test failed, %d problems\n", len(r.Problems))
+	}
+	return buf.WriteTo(w)
+}
+
+// Check loads the configuration file without starting anything, like "nginx -t".
+//
+// The error is returned if the configuration can't be loaded, the problems
+// found by Validate and by decoding the programs with ToProgramConfig are
+// reported in the Report
+func Check(path string) (Report, error) {
+	c := NewConfig(path)
+	if _, err := c.Load(); err != nil {
+		return Report{}, err
+	}
+	report := Report{Files: c.GetFiles(),
+		Programs:  c.GetProgramNames(),
+		Problems:  c.Validate(),
+		Effective: c.effectiveString()}
+	reported := make(map[ValidationError]bool)
+	for _, problem := range report.Problems {
+		reported[problem] = true
+	}
+	for _, entry := range c.GetProgramsSorted() {
+		if _, err := entry.ToProgramConfig(); err != nil {
+			errs, ok := err.(ValidationErrors)
+			if !ok {
+				errs = ValidationErrors{{Section: entry.sectionName(), Msg: err.Error()}}
+			}
+			for _, problem := range errs {
+				if problem.File == "" {
+					if problem.File, problem.Line = entry.Source(problem.Key); problem.File == "" {
+						problem.File, problem.Line = entry.Source("")
+					}
+				}
+				if !reported[problem] {
+					reported[problem] = true
+					report.Problems = append(report.Problems, problem)
+				}
+			}
+		}
+	}
+	return report, nil
+}
+
+// the configuration like String with the values evaluated like ExportJSON
+func (c *Config) effectiveString() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	buf := bytes.NewBuffer(make([]byte, 0))
+	for _, entry := range c.entriesOrdered(func(entry *Entry) bool { return true }, ByName) {
+		keyValues := entry.copyKeyValues()
+		keys := make([]string, 0, len(keyValues))
+		for key := range keyValues {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(buf, "[%s]\n", entry.Name)
+		for _, key := range keys {
+			fmt.Fprintf(buf, "%s=%s\n", key, entry.getStringExpression(key, "", false))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/ochinchina/go-ini"
+)
+
+// the legacy supervisord sections and the zssld sections they are accepted
+// as, see SetSupervisordCompat
+var supervisordAliases = map[string]string{
+	"supervisord":   "zssld",
+	"supervisorctl": "zsslctl",
+}
+
+// check if the section is a legacy supervisord section
+func isSupervisordSection(name string) bool {
+	_, ok := supervisordAliases[name]
+	return ok || strings.HasPrefix(name, "rpcinterface:")
+}
+
+// SetSupervisordCompat sets the supervisord compatibility mode. In the
+// compatibility mode the [supervisord] and [supervisorctl] sections are loaded
+// as the [zssld] and [zsslctl] sections, and the [rpcinterface:x] sections are
+// ignored as the RPC interface is built into zssld, so the supervisord
+// configuration files can be loaded unmodified. The keys of [zssld] override
+// the same keys of [supervisord] if both of them are present.
+//
+// The legacy sections are reported by Validate if the mode is not set
+func (c *Config) SetSupervisordCompat(compat bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.compat = compat
+}
+
+// replace the legacy supervisord sections of cfg by the zssld sections, the
+// declaration order and the locations of the keys are moved to the zssld
+// sections also
+func applySupervisordAliases(cfg *ini.Ini, sectionOrder map[string]int, locations map[string]map[string]keyLocation, logger *loadLogger) *ini.Ini {
+	result := ini.NewIni()
+	for _, section := range cfg.Sections() {
+		if !isSupervisordSection(section.Name) {
+			target := result.NewSection(section.Name)
+			for _, key := range section.Keys() {
+				target.Add(key.Name(), key.ValueWithDefault(""))
+			}
+		}
+	}
+	for _, section := range cfg.Sections() {
+		name, ok := supervisordAliases[section.Name]
+		if !ok {
+			if isSupervisordSection(section.Name) {
+				logger.log(InfoLevel, "the supervisord rpcinterface section is ignored", Fields{"section": section.Name})
+				delete(sectionOrder, section.Name)
+				delete(locations, section.Name)
+			}
+			continue
+		}
+		target := result.NewSection(name)
+		for _, key := range section.Keys() {
+			if !target.HasKey(key.Name()) {
+				target.Add(key.Name(), key.ValueWithDefault(""))
+			}
+		}
+		if order, ok := sectionOrder[section.Name]; ok {
+			if targetOrder, found := sectionOrder[name]; !found || order < targetOrder {
+				sectionOrder[name] = order
+			}
+		}
+		if _, ok := locations[name]; !ok {
+			locations[name] = make(map[string]keyLocation)
+		}
+		for key, location := range locations[section.Name] {
+			if _, found := locations[name][key]; !found {
+				locations[name][key] = location
+			}
+		}
+		delete(sectionOrder, section.Name)
+		delete(locations, section.Name)
+	}
+	return result
+}
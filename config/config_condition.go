@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// the operators of the conditions, the longer operators are matched first
+var conditionOperators = []string{"==", "!=", "=~", "!~"}
+
+// the values of the variables of the conditions on this host
+var conditionVariables = map[string]func() string{
+	"hostname": func() string {
+		hostname, _ := getHostname()
+		return hostname
+	},
+	"os":   func() string { return runtime.GOOS },
+	"arch": func() string { return runtime.GOARCH },
+}
+
+// condition compares a variable of the host with a value
+type condition struct {
+	variable string
+	op       string
+	value    string
+	pattern  *regexp.Regexp
+}
+
+// parse the "condition" value, the conditions separated by "," must all be
+// met. A condition is the variable hostname, os or arch, the operator and the
+// value, the operator "==" and "!=" compare the value and "=~" and "!~" match
+// the value as an anchored regular expression:
+//
+//	condition = os==linux, hostname=~web-.*
+//
+// The conditions with "," are quoted, e.g. "hostname=~web-[0-9]{1,3}"
+func parseConditions(s string) ([]condition, error) {
+	result := make([]condition, 0)
+	for _, expr := range splitBySep(s, ",") {
+		pos, op := -1, ""
+		for _, o := range conditionOperators {
+			if i := strings.Index(expr, o); i != -1 && (pos == -1 || i < pos) {
+				pos, op = i, o
+			}
+		}
+		if pos == -1 {
+			return nil, fmt.Errorf("invalid condition %q, no ==, !=, =~ or !~", expr)
+		}
+		c := condition{variable: strings.TrimSpace(expr[:pos]), op: op, value: strings.TrimSpace(expr[pos+len(op):])}
+		if _, ok := conditionVariables[c.variable]; !ok {
+			return nil, fmt.Errorf("invalid condition %q, unknown variable %q", expr, c.variable)
+		}
+		if op == "=~" || op == "!~" {
+			pattern, err := regexp.Compile("^(?:" + c.value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid condition %q: %v", expr, err)
+			}
+			c.pattern = pattern
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// check if the condition is met on this host
+func (c condition) met() bool {
+	value := conditionVariables[c.variable]()
+	switch c.op {
+	case "==":
+		return value == c.value
+	case "!=":
+		return value != c.value
+	case "=~":
+		return c.pattern.MatchString(value)
+	default:
+		return !c.pattern.MatchString(value)
+	}
+}
+
+// check if all the conditions of the "condition" value s are met on this host
+func conditionsMet(s string) (bool, error) {
+	conditions, err := parseConditions(s)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range conditions {
+		if !c.met() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
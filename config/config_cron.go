@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lettered/zssld-tools/faults"
+)
+
+// CronSchedule a parsed cron expression, see Entry.GetCron
+type CronSchedule struct {
+	// Expr the expression without the time zone
+	Expr string
+	// Location the time zone the expression is evaluated in
+	Location *time.Location
+
+	// the bit sets of the matched values of the fields
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// the day of month or the day of week field is "*"
+	anyDay     bool
+	anyWeekday bool
+}
+
+// the range and the names of the values of a cron field
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+// the minute, hour, day of month, month and day of week fields
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}},
+	// both 0 and 7 are Sunday
+	{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}},
+}
+
+// the predefined schedules
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// the longest time searched for the next activation, every valid expression
+// matches in 5 years including the 29th of February
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// parse the cron expression with the optional time zone suffix, the expression
+// is evaluated in the local time zone if no time zone is given
+func parseCron(s string) (*CronSchedule, error) {
+	fail := func(msg string) (*CronSchedule, error) {
+		return nil, faults.NewFault(faults.BadArguments, fmt.Sprintf("invalid cron expression %q: %s", s, msg))
+	}
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return fail("empty expression")
+	}
+	n := 5
+	if strings.HasPrefix(fields[0], "@") {
+		n = 1
+	}
+	if len(fields) != n && len(fields) != n+1 {
+		return fail(fmt.Sprintf("expect %d fields and an optional time zone", n))
+	}
+	schedule := &CronSchedule{Expr: strings.Join(fields[:n], " "), Location: time.Local}
+	if len(fields) == n+1 {
+		location, err := time.LoadLocation(fields[n])
+		if err != nil {
+			return fail(fmt.Sprintf("unknown time zone %q", fields[n]))
+		}
+		schedule.Location = location
+	}
+	if n == 1 {
+		expr, ok := cronMacros[strings.ToLower(fields[0])]
+		if !ok {
+			return fail(fmt.Sprintf("unknown schedule %q", fields[0]))
+		}
+		fields = strings.Fields(expr)
+	}
+	sets := make([]uint64, len(cronFields))
+	for i, field := range cronFields {
+		set, err := parseCronField(fields[i], field)
+		if err != nil {
+			return fail(err.Error())
+		}
+		sets[i] = set
+	}
+	// Sunday is both 0 and 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	schedule.minutes, schedule.hours, schedule.days, schedule.months, schedule.weekdays = sets[0], sets[1], sets[2], sets[3], sets[4]
+	schedule.anyDay, schedule.anyWeekday = fields[2] == "*", fields[4] == "*"
+	if schedule.Next(time.Now()).IsZero() {
+		return fail("never matches")
+	}
+	return schedule, nil
+}
+
+// parse the comma separated values, ranges and steps of the field to a bit set
+func parseCronField(s string, field cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(s, ",") {
+		rangePart, step := part, 1
+		if pos := strings.Index(part, "/"); pos != -1 {
+			i, err := strconv.Atoi(part[pos+1:])
+			if err != nil || i <= 0 {
+				return 0, fmt.Errorf("invalid step in %s %q", field.name, part)
+			}
+			rangePart, step = part[:pos], i
+		}
+		low, high := field.min, field.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = parseCronValue(bounds[0], field); err != nil {
+				return 0, err
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = parseCronValue(bounds[1], field); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// "a/step" starts from a to the max value
+				high = field.max
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range in %s %q", field.name, part)
+			}
+		}
+		for i := low; i <= high; i += step {
+			set |= 1 << uint(i)
+		}
+	}
+	return set, nil
+}
+
+// parse the number or the name of the field value
+func parseCronValue(s string, field cronField) (int, error) {
+	if i, ok := field.names[strings.ToLower(s)]; ok {
+		return i, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < field.min || i > field.max {
+		return 0, fmt.Errorf("invalid %s %q", field.name, s)
+	}
+	return i, nil
+}
+
+// check if the day matches the day of month and the day of week fields, the
+// day matches either of them if both are restricted like the standard cron
+func (s *CronSchedule) matchDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// Next returns the first activation time of the schedule after t in the time
+// zone of the schedule, the zero time is returned if none is found
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.Location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.Location)
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.Location)
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.Location)
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// String returns the expression with the time zone
+func (s *CronSchedule) String() string {
+	return s.Expr + " " + s.Location.String()
+}
+
+// GetCron gets value of the key as a cron expression of 5 fields, minute,
+// hour, day of month, month and day of week, or one of @yearly, @monthly,
+// @weekly, @daily and @hourly, followed by an optional time zone:
+//
+//	schedule=*/15 * * * *
+//	schedule=0 3 * * mon-fri Europe/Paris
+//	schedule=@daily UTC
+//
+// The expression is evaluated in the local time zone if no time zone is given.
+// An error is returned if the key is missing or the expression is invalid
+func (c *Entry) GetCron(key string) (*CronSchedule, error) {
+	value, ok := c.lookup(key)
+	if !ok {
+		return nil, faults.NewFault(faults.BadArguments, fmt.Sprintf("no %s in %s", key, c.Name))
+	}
+	return parseCron(value)
+}
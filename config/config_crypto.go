@@ -0,0 +1,127 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/lettered/zssld-tools/faults"
+)
+
+// the environment variables of the master key decrypting the ENC[...] values,
+// the base64 encoded key or the file of the key
+const (
+	MasterKeyEnv     = "ZSSLD_MASTER_KEY"
+	MasterKeyFileEnv = "ZSSLD_MASTER_KEY_FILE"
+)
+
+// the encrypted values, ENC[base64 of the nonce and the AES-GCM sealed value]
+var encryptedPattern = regexp.MustCompile(`ENC\[([A-Za-z0-9+/=]*)\]`)
+
+// the master key set by SetMasterKey
+var masterKey struct {
+	sync.RWMutex
+	key []byte
+}
+
+// SetMasterKey sets the AES key of 16, 24 or 32 bytes decrypting the ENC[...]
+// values. The key is read from MasterKeyEnv or MasterKeyFileEnv if not set
+func SetMasterKey(key []byte) error {
+	if _, err := aes.NewCipher(key); err != nil {
+		return faults.NewFault(faults.BadArguments, err.Error())
+	}
+	masterKey.Lock()
+	defer masterKey.Unlock()
+	masterKey.key = append([]byte(nil), key...)
+	return nil
+}
+
+// get the master key set by SetMasterKey or from the environment variables
+func getMasterKey() ([]byte, error) {
+	masterKey.RLock()
+	key := masterKey.key
+	masterKey.RUnlock()
+	if key != nil {
+		return key, nil
+	}
+	encoded := os.Getenv(MasterKeyEnv)
+	if encoded == "" {
+		file := os.Getenv(MasterKeyFileEnv)
+		if file == "" {
+			return nil, faults.NewFault(faults.BadArguments, fmt.Sprintf("no master key in %s or %s", MasterKeyEnv, MasterKeyFileEnv))
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, faults.NewFault(faults.NoFile, err.Error())
+		}
+		encoded = string(b)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, faults.NewFault(faults.BadArguments, fmt.Sprintf("invalid master key: %v", err))
+	}
+	return key, nil
+}
+
+// get the AES-GCM cipher of the master key
+func masterKeyCipher() (cipher.AEAD, error) {
+	key, err := getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, faults.NewFault(faults.BadArguments, fmt.Sprintf("invalid master key: %v", err))
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptValue encrypts the value with the master key to ENC[...], which is
+// decrypted by Entry.GetString and Entry.GetEnv
+func EncryptValue(value string) (string, error) {
+	gcm, err := masterKeyCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", faults.NewFault(faults.Failed, err.Error())
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return "ENC[" + base64.StdEncoding.EncodeToString(sealed) + "]", nil
+}
+
+// decrypt the ENC[...] values in s with the master key
+func decryptValues(s string) (string, error) {
+	if !strings.Contains(s, "ENC[") {
+		return s, nil
+	}
+	gcm, err := masterKeyCipher()
+	if err != nil {
+		return "", err
+	}
+	var decryptErr error
+	result := encryptedPattern.ReplaceAllStringFunc(s, func(enc string) string {
+		sealed, err := base64.StdEncoding.DecodeString(encryptedPattern.FindStringSubmatch(enc)[1])
+		if err != nil || len(sealed) < gcm.NonceSize() {
+			decryptErr = faults.NewFault(faults.BadArguments, "invalid encrypted value")
+			return enc
+		}
+		plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+		if err != nil {
+			decryptErr = faults.NewFault(faults.BadArguments, fmt.Sprintf("fail to decrypt value: %v", err))
+			return enc
+		}
+		return string(plain)
+	})
+	if decryptErr != nil {
+		return "", decryptErr
+	}
+	return result, nil
+}
@@ -3,10 +3,16 @@ package config
 import (
 	"bytes"
 	"fmt"
-	"os"
+	"math"
+	"math/big"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/lettered/zssld-tools/faults"
+	"github.com/lettered/zssld-tools/logger"
 	"github.com/ochinchina/go-ini"
 	log "github.com/sirupsen/logrus"
 )
@@ -16,7 +22,32 @@ type Entry struct {
 	ConfigDir string
 	Group     string
 	Name      string
+	// the key values and the keys set by SetString after parsing, they are
+	// guarded by keyLock as SetString may change them while they are read
+	keyLock   sync.RWMutex
 	keyValues map[string]string
+	modified  map[string]bool
+	// the name of the section the entry is parsed from
+	section string
+	// the locations of the keys in the loaded files, the section header is
+	// keyed by "". They are guarded by cacheLock as the unchanged entries are
+	// kept and located again by the reloading
+	locations map[string]keyLocation
+	// the childlogdir and identifier of [zssld] naming the AUTO log files of
+	// the programs and event listeners
+	childLogDir string
+	identifier  string
+	// the entry belongs to a snapshot and can't be changed
+	readOnly bool
+	// the access hook and the logger of the configuration of the entry
+	access *accessHooks
+	logs   *configLogs
+
+	// the evaluated values of the keys, reset when the key values change
+	cacheLock   sync.Mutex
+	stringCache map[string]string
+	exprCache   map[string]string
+	envCache    map[string][]string
 }
 
 // GetName returns true if this is a section
@@ -55,22 +86,19 @@ func (c *Entry) IsGroup() bool {
 	return strings.HasPrefix(c.Name, "group:")
 }
 
-// GetGroupName returns group name if entry is a group
+// GetGroupName returns group name if entry is a group, or the group of the
+// program entry set by the [group:x] sections
 func (c *Entry) GetGroupName() string {
 	if strings.HasPrefix(c.Name, "group:") {
 		return c.Name[len("group:"):]
 	}
-	return ""
+	return c.Group
 }
 
 // GetPrograms returns slice with programs from the group
 func (c *Entry) GetPrograms() []string {
 	if c.IsGroup() {
-		r := c.GetStringArray("programs", ",")
-		for i, p := range r {
-			r[i] = strings.TrimSpace(p)
-		}
-		return r
+		return c.GetStringSliceMultiSep("programs", listSeparators)
 	}
 	return make([]string, 0)
 }
@@ -79,31 +107,162 @@ func (c *Entry) setGroup(group string) {
 	c.Group = group
 }
 
+// check if the entry has the same name, group, directory and key values as other
+func (c *Entry) equals(other *Entry) bool {
+	if c.Name != other.Name || c.Group != other.Group || c.ConfigDir != other.ConfigDir ||
+		c.childLogDir != other.childLogDir || c.identifier != other.identifier {
+		return false
+	}
+	keyValues, otherKeyValues := c.copyKeyValues(), other.copyKeyValues()
+	if len(keyValues) != len(otherKeyValues) {
+		return false
+	}
+	for k, v := range keyValues {
+		if otherValue, ok := otherKeyValues[k]; !ok || otherValue != v {
+			return false
+		}
+	}
+	return true
+}
+
+// copy the key values of the entry
+func (c *Entry) copyKeyValues() map[string]string {
+	c.keyLock.RLock()
+	defer c.keyLock.RUnlock()
+	result := make(map[string]string, len(c.keyValues))
+	for key, value := range c.keyValues {
+		result[key] = value
+	}
+	return result
+}
+
+// check if the key is set by SetString
+func (c *Entry) isModified(key string) bool {
+	c.keyLock.RLock()
+	defer c.keyLock.RUnlock()
+	return c.modified[key]
+}
+
+// drop all the cached evaluated values. The caches are cleared rather than
+// replaced, as the getters pick the cache before taking cacheLock
+func (c *Entry) resetCache() {
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+	for key := range c.stringCache {
+		delete(c.stringCache, key)
+	}
+	for key := range c.exprCache {
+		delete(c.exprCache, key)
+	}
+	for key := range c.envCache {
+		delete(c.envCache, key)
+	}
+}
+
+// get the cached value of key from cache
+func (c *Entry) getCached(cache map[string]string, key string) (string, bool) {
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+	value, ok := cache[key]
+	return value, ok
+}
+
+// store the evaluated value of key to cache
+func (c *Entry) setCached(cache map[string]string, key string, value string) {
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+	cache[key] = value
+}
+
 // String dumps configuration as a string
 func (c *Entry) String() string {
 	buf := bytes.NewBuffer(make([]byte, 0))
-	for k, v := range c.keyValues {
-		fmt.Fprintf(buf, "%s=%s\n", k, v)
+	keyValues := c.copyKeyValues()
+	keys := make([]string, 0, len(keyValues))
+	for k := range keyValues {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "%s=%s\n", k, keyValues[k])
 	}
 	return buf.String()
 }
 
-// GetBool gets value of key as bool
+// GetBool gets value of key as bool. Besides the values accepted by strconv.ParseBool,
+// yes/no, y/n and on/off are accepted case-insensitively
 func (c *Entry) GetBool(key string, defValue bool) bool {
-	value, ok := c.keyValues[key]
+	value, ok := c.lookup(key)
 
 	if ok {
-		b, err := strconv.ParseBool(value)
+		b, err := parseBool(value)
 		if err == nil {
 			return b
 		}
+		c.log(WarnLevel, "invalid bool value, use default", Fields{
+			"program": c.GetProgramName(),
+			"key":     key,
+			"value":   value,
+		})
 	}
 	return defValue
 }
 
+// parse the supervisor bool value
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true, nil
+	case "0", "f", "false", "n", "no", "off":
+		return false, nil
+	}
+	return false, faults.NewFault(faults.BadArguments, fmt.Sprintf("invalid bool value %q", s))
+}
+
+// parse the log rotation period with the parser of the loggers, the empty
+// value and "none" are returned as "none" for the logs rotated only by size
+func parseRotate(s string) (string, error) {
+	rotate, err := logger.ParseRotatePolicy(s)
+	if err != nil {
+		return "", faults.NewFault(faults.BadArguments, err.Error())
+	}
+	return rotate.String(), nil
+}
+
+// GetLogProps returns the props of logger.NewLogger for the log of the
+// channel, "stdout" or "stderr", or for the log of [zssld] if channel is
+// empty. The syslog keys are passed as they are and the
+// "<channel>_logfile_rotate" key is passed as "logfile_rotate", the invalid
+// rotation period is logged and the log is rotated by size only
+func (c *Entry) GetLogProps(channel string) map[string]string {
+	props := make(map[string]string)
+	for _, key := range []string{"syslog_priority", "syslog_facility", "syslog_tag"} {
+		if value, ok := c.lookup(key); ok {
+			props[key] = value
+		}
+	}
+	key := "logfile_rotate"
+	if channel != "" {
+		key = channel + "_" + key
+	}
+	if value, ok := c.lookup(key); ok {
+		rotate, err := parseRotate(value)
+		if err != nil {
+			c.log(WarnLevel, "invalid log rotation period, rotate by size only", Fields{
+				log.ErrorKey: err,
+				"program":    c.GetProgramName(),
+				"key":        key,
+			})
+			rotate = "none"
+		}
+		props["logfile_rotate"] = rotate
+	}
+	return props
+}
+
 // HasParameter checks if key (parameter) has value
 func (c *Entry) HasParameter(key string) bool {
-	_, ok := c.keyValues[key]
+	_, ok := c.rawLookup(key)
 	return ok
 }
 
@@ -117,7 +276,7 @@ func toInt(s string, factor int, defValue int) int {
 
 // GetInt gets value of the key as int
 func (c *Entry) GetInt(key string, defValue int) int {
-	value, ok := c.keyValues[key]
+	value, ok := c.lookup(key)
 
 	if ok {
 		return toInt(value, 1, defValue)
@@ -125,25 +284,128 @@ func (c *Entry) GetInt(key string, defValue int) int {
 	return defValue
 }
 
+// GetInt64 gets value of the key as int64, the defValue is returned if the value is invalid
+func (c *Entry) GetInt64(key string, defValue int64) int64 {
+	value, ok := c.lookup(key)
+
+	if ok {
+		i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err == nil {
+			return i
+		}
+		c.log(WarnLevel, "invalid int64 value, use default", Fields{
+			log.ErrorKey: err,
+			"program":    c.GetProgramName(),
+			"key":        key,
+		})
+	}
+	return defValue
+}
+
+// GetFloat64 gets value of the key as float64, the defValue is returned if the
+// value is invalid, NaN or infinite
+func (c *Entry) GetFloat64(key string, defValue float64) float64 {
+	value, ok := c.lookup(key)
+
+	if ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+		c.log(WarnLevel, "invalid float value, use default", Fields{
+			"program": c.GetProgramName(),
+			"key":     key,
+			"value":   value,
+		})
+	}
+	return defValue
+}
+
+// GetDuration gets value of the key as duration, the value is the number of
+// seconds or a duration like "10s", "5m" and "1h30m".
+//
+// The defValue is returned if the value is invalid or negative
+func (c *Entry) GetDuration(key string, defValue time.Duration) time.Duration {
+	value, ok := c.lookup(key)
+
+	if ok {
+		d, err := parseDuration(value)
+		if err == nil {
+			return d
+		}
+		c.log(WarnLevel, "invalid duration value, use default", Fields{
+			log.ErrorKey: err,
+			"program":    c.GetProgramName(),
+			"key":        key,
+		})
+	}
+	return defValue
+}
+
+// parse the duration in seconds or in the format of time.ParseDuration
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	var d time.Duration
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil && i <= math.MaxInt64/int64(time.Second) {
+		d = time.Duration(i) * time.Second
+	} else if d, err = time.ParseDuration(s); err != nil {
+		return 0, faults.NewFault(faults.BadArguments, fmt.Sprintf("invalid duration value %q", s))
+	}
+	if d < 0 {
+		return 0, faults.NewFault(faults.BadArguments, fmt.Sprintf("invalid duration value %q", s))
+	}
+	return d, nil
+}
+
 // GetEnv returns slice of strings with keys separated from values by single "=". An environment string example:
 //
 //	environment = A="env 1",B="this is a test"
+//
+// The ENC[...] values are decrypted with the master key, see EncryptValue
 func (c *Entry) GetEnv(key string) []string {
-	value, ok := c.keyValues[key]
+	value, ok := c.lookup(key)
+	c.cacheLock.Lock()
+	cached, found := c.envCache[key]
+	c.cacheLock.Unlock()
+	if found {
+		return append(make([]string, 0, len(cached)), cached...)
+	}
+
 	result := make([]string, 0)
 
 	if ok {
-		for k, v := range *parseEnv(value) {
+		envs, err := ParseEnvironment(value)
+		if err != nil {
+			c.log(WarnLevel, "unable to parse environment", Fields{
+				log.ErrorKey: err,
+				"program":    c.GetProgramName(),
+				"key":        key,
+			})
+		}
+		for k, v := range envs {
 			tmp, err := NewStringExpression("program_name", c.GetProgramName(),
-				"process_num", c.GetString("process_num", "0"),
+				"process_num", c.getString("process_num", "0", false),
 				"group_name", c.GetGroupName(),
 				"here", c.ConfigDir).Eval(fmt.Sprintf("%s=%s", k, v))
+			if err == nil {
+				tmp, err = decryptValues(tmp)
+			}
 			if err == nil {
 				result = append(result, tmp)
+			} else {
+				c.log(WarnLevel, "unable to get environment value", Fields{
+					log.ErrorKey: err,
+					"program":    c.GetProgramName(),
+					"key":        key,
+					"env":        k,
+				})
 			}
 		}
 	}
 
+	c.cacheLock.Lock()
+	c.envCache[key] = append(make([]string, 0, len(result)), result...)
+	c.cacheLock.Unlock()
 	return result
 }
 
@@ -153,14 +415,19 @@ func (c *Entry) GetEnv(key string) []string {
 //
 // cat global.env
 // varA=valueA
+//
+// "%(here)s" in the file names is the directory of the configuration file,
+// e.g. envFiles = %(here)s/prod.env for the env files of a bundle. The files
+// are read on every call, see WatchOptions.EnvFiles to be notified when they
+// are changed
 func (c *Entry) GetEnvFromFiles(key string) []string {
-	value, ok := c.keyValues[key]
+	value, ok := c.lookup(key)
 	result := make([]string, 0)
 
 	if ok {
-		for k, v := range *parseEnvFiles(value) {
+		for k, v := range *c.parseEnvFiles(c.expandHere(value)) {
 			tmp, err := NewStringExpression("program_name", c.GetProgramName(),
-				"process_num", c.GetString("process_num", "0"),
+				"process_num", c.getString("process_num", "0", false),
 				"group_name", c.GetGroupName(),
 				"here", c.ConfigDir).Eval(fmt.Sprintf("%s=%s", k, v))
 			if err == nil {
@@ -172,64 +439,162 @@ func (c *Entry) GetEnvFromFiles(key string) []string {
 	return result
 }
 
-// GetString returns value of the key as a string
+// expand "%(here)s" in the value to the directory of the configuration file,
+// the value is kept if it can't be evaluated
+func (c *Entry) expandHere(value string) string {
+	if result, err := NewStringExpression("here", c.ConfigDir).Eval(value); err == nil {
+		return result
+	}
+	return value
+}
+
+// GetString returns value of the key as a string, the ENC[...] values are
+// decrypted with the master key, see EncryptValue
 func (c *Entry) GetString(key string, defValue string) string {
-	s, ok := c.keyValues[key]
+	return c.getString(key, defValue, true)
+}
+
+// get the value of the key as a string like GetString, the access hook is
+// notified only if notify is true
+func (c *Entry) getString(key string, defValue string, notify bool) string {
+	s, ok := c.find(key, notify)
+	if repS, found := c.getCached(c.stringCache, key); found {
+		return repS
+	}
 
 	if ok {
 		env := NewStringExpression("here", c.ConfigDir)
 		repS, err := env.Eval(s)
+		if err != nil {
+			c.log(WarnLevel, "Unable to parse expression", Fields{
+				log.ErrorKey: err,
+				"program":    c.GetProgramName(),
+				"key":        key,
+			})
+			return defValue
+		}
+		repS, err = decryptValues(repS)
 		if err == nil {
+			c.setCached(c.stringCache, key, repS)
 			return repS
 		}
-		log.WithFields(log.Fields{
+		c.log(WarnLevel, "unable to decrypt value", Fields{
 			log.ErrorKey: err,
 			"program":    c.GetProgramName(),
 			"key":        key,
-		}).Warn("Unable to parse expression")
+		})
 	}
 	return defValue
 }
 
+// Source returns the file and the line the key is defined at, the key is
+// inherited from a template or [program-default] if the location is in their
+// sections. The line is 0 if the key is not from a file, e.g. "process_num" or
+// a key set by SetString
+func (c *Entry) Source(key string) (string, int) {
+	if c.isModified(key) {
+		return "", 0
+	}
+	c.cacheLock.Lock()
+	location, ok := c.locations[key]
+	c.cacheLock.Unlock()
+	if !ok {
+		return "", 0
+	}
+	return location.file, location.line
+}
+
+// set the locations of the keys found by the loading
+func (c *Entry) setLocations(locations map[string]keyLocation) {
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+	c.locations = locations
+}
+
+// SetString sets value of the key, the entries of a snapshot are not changed
 func (c *Entry) SetString(key string, value string) {
+	if c.readOnly {
+		c.log(WarnLevel, "the entry of the configuration snapshot can't be changed", Fields{"section": c.Name, "key": key})
+		return
+	}
+	c.keyLock.Lock()
 	c.keyValues[key] = strings.TrimSpace(value)
+	c.modified[key] = true
+	c.keyLock.Unlock()
+	c.resetCache()
 }
 
-// GetStringExpression returns value of key as a string and attempts to parse it with StringExpression
+// GetStringExpression returns value of key as a string and attempts to parse it with StringExpression,
+// defValue is returned if the key is missing
 func (c *Entry) GetStringExpression(key string, defValue string) string {
-	s, ok := c.keyValues[key]
-	if !ok || s == "" {
+	return c.getStringExpression(key, defValue, true)
+}
+
+// get the value of the key evaluated like GetStringExpression, the access
+// hook is notified only if notify is true
+func (c *Entry) getStringExpression(key string, defValue string, notify bool) string {
+	s, ok := c.find(key, notify)
+	if !ok {
+		return defValue
+	}
+	if s == "" {
 		return ""
 	}
+	if result, found := c.getCached(c.exprCache, key); found {
+		return result
+	}
 
-	hostName, err := os.Hostname()
+	hostName, err := getHostname()
 	if err != nil {
 		hostName = "Unknown"
 	}
-	result, err := NewStringExpression("program_name", c.GetProgramName(),
-		"process_num", c.GetString("process_num", "0"),
+	programName := c.GetProgramName()
+	if programName == "" {
+		programName = c.GetEventListenerName()
+	}
+	result, err := NewStringExpression("program_name", programName,
+		"process_num", c.getString("process_num", "0", false),
 		"group_name", c.GetGroupName(),
 		"here", c.ConfigDir,
 		"host_node_name", hostName).Eval(s)
 
 	if err != nil {
-		log.WithFields(log.Fields{
+		c.log(WarnLevel, "unable to parse expression", Fields{
 			log.ErrorKey: err,
 			"program":    c.GetProgramName(),
 			"key":        key,
-		}).Warn("unable to parse expression")
+		})
 		return s
 	}
 
+	c.setCached(c.exprCache, key, result)
 	return result
 }
 
-// GetStringArray gets string value and split it with "sep" to slice
+// GetStringArray gets string value and split it with "sep" to slice. The
+// elements are trimmed and the empty elements are removed, and the parts of
+// the elements quoted by " or ' may contain sep:
+//
+//	depends_on = db, "my cache"
 func (c *Entry) GetStringArray(key string, sep string) []string {
-	s, ok := c.keyValues[key]
+	s, ok := c.lookup(key)
 
 	if ok {
-		return strings.Split(s, sep)
+		return splitBySep(s, sep)
+	}
+	return make([]string, 0)
+}
+
+// GetStringSliceMultiSep gets string value and split it with any char of seps
+// to slice like GetStringArray, e.g. the "programs" of the groups are
+// separated by commas or spaces:
+//
+//	programs = web, "my worker" cron
+func (c *Entry) GetStringSliceMultiSep(key string, seps string) []string {
+	s, ok := c.lookup(key)
+
+	if ok {
+		return splitByAny(s, seps)
 	}
 	return make([]string, 0)
 }
@@ -240,28 +605,117 @@ func (c *Entry) GetStringArray(key string, sep string) []string {
 //	logSize=1GB
 //	logSize=1KB
 //	logSize=1024
-func (c *Entry) GetBytes(key string, defValue int) int {
-	v, ok := c.keyValues[key]
+//	logSize=1.5GB
+//	logSize=512kb
+//	logSize=2 TB
+//	logSize=1GiB
+//
+// The suffixes are case-insensitive and all of them are multiples of 1024.
+// The fractional bytes are dropped, and the defValue is returned if the value
+// is invalid or overflows int64
+func (c *Entry) GetBytes(key string, defValue int64) int64 {
+	v, ok := c.lookup(key)
 
 	if ok {
-		if len(v) > 2 {
-			lastTwoBytes := v[len(v)-2:]
-			if lastTwoBytes == "MB" {
-				return toInt(v[:len(v)-2], 1024*1024, defValue)
-			} else if lastTwoBytes == "GB" {
-				return toInt(v[:len(v)-2], 1024*1024*1024, defValue)
-			} else if lastTwoBytes == "KB" {
-				return toInt(v[:len(v)-2], 1024, defValue)
-			}
+		i, err := parseBytes(v)
+		if err == nil {
+			return i
 		}
-		return toInt(v, 1, defValue)
+		c.log(WarnLevel, "invalid bytes value, use default", Fields{
+			log.ErrorKey: err,
+			"program":    c.GetProgramName(),
+			"key":        key,
+		})
 	}
 	return defValue
 }
 
+// the factors of the bytes setting suffixes
+var byteUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+// parse the bytes setting with optional unit suffix, e.g. "1.5GB" or "512 kib"
+func parseBytes(v string) (int64, error) {
+	s := strings.TrimSpace(v)
+	n := 0
+	for n < len(s) && (s[n] >= '0' && s[n] <= '9' || s[n] == '.') {
+		n++
+	}
+	factor, ok := byteUnits[strings.ToLower(strings.TrimSpace(s[n:]))]
+	num, numOk := new(big.Rat).SetString(s[:n])
+	if !ok || n == 0 || !numOk {
+		return 0, faults.NewFault(faults.BadArguments, fmt.Sprintf("invalid bytes value %q", v))
+	}
+	num.Mul(num, new(big.Rat).SetInt64(factor))
+	// the fractional bytes are dropped
+	i := new(big.Int).Quo(num.Num(), num.Denom())
+	if !i.IsInt64() {
+		return 0, faults.NewFault(faults.BadArguments, fmt.Sprintf("invalid bytes value %q", v))
+	}
+	return i.Int64(), nil
+}
+
+// parse the keys of the program or event listener section for one of its
+// processes, the evaluated process keys override the keys of the section which
+// is shared by all the processes and is not changed
+func (c *Entry) parseProcess(section *ini.Section, processKeys map[string]string) {
+	c.parse(section)
+	for key, value := range processKeys {
+		c.keyValues[key] = value
+	}
+}
+
+// parse the keys of the section, the "%(ENV_X)s" references in the values are
+// expanded with the environment of the process at parse time
 func (c *Entry) parse(section *ini.Section) {
 	c.Name = section.Name
+	c.section = section.Name
+	c.modified = make(map[string]bool)
 	for _, key := range section.Keys() {
-		c.keyValues[key.Name()] = strings.TrimSpace(key.ValueWithDefault(""))
+		value := strings.TrimSpace(key.ValueWithDefault(""))
+		if !commandKeys[key.Name()] {
+			value = unquoteValue(value)
+		}
+		c.keyValues[key.Name()] = expandOSEnv(value)
+	}
+	for key, replacement := range deprecatedKeys[sectionType(c.Name)] {
+		if value, ok := c.keyValues[key]; ok {
+			if _, found := c.keyValues[replacement]; !found {
+				c.keyValues[replacement] = value
+			}
+		}
+	}
+	c.resetCache()
+}
+
+// the keys of the commands, the quotes in them group the words to the arguments
+// so they are kept. The quotes of the conditions are kept also as they group
+// the conditions with ","
+var commandKeys = map[string]bool{
+	"command":                         true,
+	"restart_cmd_when_binary_changed": true,
+	"condition":                       true,
+}
+
+// remove the quotes enclosing the whole value, e.g. "/opt/my app" or 'TERM',
+// the quotes inside the value are kept, e.g. A="1",B="2"
+func unquoteValue(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && closingQuote(s, 0) == len(s)-1 {
+		return s[1 : len(s)-1]
 	}
+	return s
 }
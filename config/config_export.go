@@ -0,0 +1,44 @@
+package config
+
+import (
+	"encoding/json"
+)
+
+// the exported configuration entry
+type exportedEntry struct {
+	Name   string            `json:"name"`
+	Group  string            `json:"group,omitempty"`
+	Values map[string]string `json:"values"`
+}
+
+// the exported configuration
+type exportedConfig struct {
+	Files   []string        `json:"files"`
+	Entries []exportedEntry `json:"entries"`
+}
+
+// ExportJSON returns the effective configuration as indented json, with the
+// entries after applying the includes, templates, defaults and numprocs
+// expansion, ordered by name. The "%(var)s" expressions in the values are
+// evaluated, and the ENC[...] values are kept encrypted:
+//
+//	{
+//	  "files": ["/etc/zssld.conf"],
+//	  "entries": [
+//	    {"name": "program:web", "values": {"command": "/bin/web"}}
+//	  ]
+//	}
+func (c *Config) ExportJSON() ([]byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	result := exportedConfig{Files: append(make([]string, 0, len(c.files)), c.files...),
+		Entries: make([]exportedEntry, 0, len(c.entries))}
+	for _, entry := range c.entriesOrdered(func(entry *Entry) bool { return true }, ByName) {
+		values := make(map[string]string)
+		for key := range entry.copyKeyValues() {
+			values[key] = entry.getStringExpression(key, "", false)
+		}
+		result.Entries = append(result.Entries, exportedEntry{Name: entry.Name, Group: entry.Group, Values: values})
+	}
+	return json.MarshalIndent(result, "", "  ")
+}
@@ -0,0 +1,287 @@
+package config
+
+import (
+	"bytes"
+	_ "embed" // for the json schema
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lettered/zssld-tools/faults"
+	"github.com/ochinchina/go-ini"
+)
+
+// the json schema of the json configuration, the json configuration has the
+// same layout as the yaml configuration
+//
+//go:embed zssld.schema.json
+var jsonSchemaData []byte
+
+// the parsed jsonSchemaData
+var configSchema = mustParseSchema(jsonSchemaData)
+
+// GetJSONSchema returns the json schema used to validate the json configuration
+func GetJSONSchema() []byte {
+	return append(make([]byte, 0, len(jsonSchemaData)), jsonSchemaData...)
+}
+
+// SchemaError a violation of the json schema found in the json configuration
+type SchemaError struct {
+	// Path the dot separated path of the value, e.g. "programs.web.command"
+	Path string
+	// Msg describes the violation
+	Msg string
+}
+
+// Error returns the path and description of the violation
+func (e *SchemaError) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return e.Path + ": " + e.Msg
+}
+
+// SchemaErrors all the violations found in the json configuration
+type SchemaErrors []*SchemaError
+
+// Error returns all the violations separated by "; "
+func (e SchemaErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// FaultCode returns the fault code of the schema violations
+func (e SchemaErrors) FaultCode() faults.FaultCode {
+	return faults.BadArguments
+}
+
+// check if the configuration file is in json format by its extension
+func isJSONFile(fileName string) bool {
+	return strings.ToLower(filepath.Ext(fileName)) == ".json"
+}
+
+// validate the json configuration against the schema and parse it to the ini
+// sections, the declaration order of the sections and the lines of the keys are
+// returned in the index
+func parseJSON(b []byte) (*ini.Ini, *sourceIndex, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, nil, faults.NewFault(faults.BadArguments, err.Error())
+	}
+	errs := make(SchemaErrors, 0)
+	configSchema.validate("", doc, &errs)
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	// json is a subset of yaml
+	return parseYaml(b)
+}
+
+// jsonSchema the subset of json schema used by zssld.schema.json
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 schemaTypes            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+	Pattern              string                 `json:"pattern"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+
+	// the schema is false and no value is allowed
+	deny bool
+	// the compiled Pattern
+	pattern *regexp.Regexp
+	// the root schema to resolve the $ref
+	root *jsonSchema
+}
+
+// schemaTypes the "type" of json schema, a single type or a list of types
+type schemaTypes []string
+
+// UnmarshalJSON accepts the single type and the list of types
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// UnmarshalJSON accepts the boolean schema besides the schema object
+func (s *jsonSchema) UnmarshalJSON(b []byte) error {
+	var allow bool
+	if err := json.Unmarshal(b, &allow); err == nil {
+		*s = jsonSchema{deny: !allow}
+		return nil
+	}
+	type plain jsonSchema
+	return json.Unmarshal(b, (*plain)(s))
+}
+
+func mustParseSchema(b []byte) *jsonSchema {
+	schema := &jsonSchema{}
+	if err := json.Unmarshal(b, schema); err != nil {
+		panic(fmt.Sprintf("invalid json schema: %v", err))
+	}
+	schema.setRoot(schema)
+	return schema
+}
+
+// set the root of the schema and all its sub-schemas and compile their
+// patterns
+func (s *jsonSchema) setRoot(root *jsonSchema) {
+	if s == nil {
+		return
+	}
+	s.root = root
+	if s.Pattern != "" {
+		s.pattern = regexp.MustCompile(s.Pattern)
+	}
+	for _, sub := range s.AnyOf {
+		sub.setRoot(root)
+	}
+	for _, sub := range s.Properties {
+		sub.setRoot(root)
+	}
+	for _, sub := range s.Definitions {
+		sub.setRoot(root)
+	}
+	s.AdditionalProperties.setRoot(root)
+	s.Items.setRoot(root)
+}
+
+// resolve the "#/definitions/name" reference
+func (s *jsonSchema) resolve() *jsonSchema {
+	if s.Ref == "" {
+		return s
+	}
+	if def, ok := s.root.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]; ok {
+		return def.resolve()
+	}
+	panic(fmt.Sprintf("unresolved json schema reference %s", s.Ref))
+}
+
+// get the json schema type of the decoded json value
+func jsonType(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// check if the value of type typ is allowed by the schema types
+func (t schemaTypes) allow(typ string) bool {
+	if len(t) == 0 {
+		return true
+	}
+	for _, allowed := range t {
+		if allowed == typ || (allowed == "number" && typ == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// join the path and the key of a sub-value
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// validate the decoded json value v at path, the violations are appended to errs
+func (s *jsonSchema) validate(path string, v interface{}, errs *SchemaErrors) {
+	s = s.resolve()
+	if s.deny {
+		*errs = append(*errs, &SchemaError{Path: path, Msg: "not allowed"})
+		return
+	}
+	typ := jsonType(v)
+	if !s.Type.allow(typ) {
+		*errs = append(*errs, &SchemaError{Path: path, Msg: fmt.Sprintf("expect %s but got %s", strings.Join(s.Type, " or "), typ)})
+		return
+	}
+	if len(s.AnyOf) > 0 {
+		s.validateAnyOf(path, v, errs)
+	}
+	switch value := v.(type) {
+	case string:
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			*errs = append(*errs, &SchemaError{Path: path, Msg: fmt.Sprintf("invalid value %q", value)})
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range value {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := value[key]; !ok {
+				*errs = append(*errs, &SchemaError{Path: joinPath(path, key), Msg: "required"})
+			}
+		}
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if sub, ok := s.Properties[key]; ok {
+				sub.validate(joinPath(path, key), value[key], errs)
+			} else if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(joinPath(path, key), value[key], errs)
+			}
+		}
+	}
+}
+
+// validate the value v at path against the "anyOf" schemas, the violations of
+// the first schema are reported if v is valid against none of them, e.g.
+// "programs.web.command: required" for the program without command, template
+// or manifest
+func (s *jsonSchema) validateAnyOf(path string, v interface{}, errs *SchemaErrors) {
+	var first SchemaErrors
+	for i, sub := range s.AnyOf {
+		subErrs := make(SchemaErrors, 0)
+		sub.validate(path, v, &subErrs)
+		if len(subErrs) == 0 {
+			return
+		}
+		if i == 0 {
+			first = subErrs
+		}
+	}
+	*errs = append(*errs, first...)
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseJSONSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"valid", `{"programs":{"web":{"command":"/bin/web","numprocs":2,"autostart":"yes","startsecs":"10s"}}}`, ""},
+		{"missing command", `{"programs":{"web":{"numprocs":2}}}`, "programs.web.command: required"},
+		{"template instead of command", `{"programs":{"web":{"use_template":"base"}}}`, ""},
+		{"manifest instead of command", `{"programs":{"web":{"manifest":"web.json"}}}`, ""},
+		{"invalid integer", `{"programs":{"web":{"command":"/bin/web","numprocs":"x"}}}`, `programs.web.numprocs: invalid value "x"`},
+		{"integer string", `{"programs":{"web":{"command":"/bin/web","numprocs":" 4 "}}}`, ""},
+		{"integer expression", `{"programs":{"web":{"command":"/bin/web","numprocs":"%(ENV_WORKERS)s"}}}`, ""},
+		{"float integer", `{"programs":{"web":{"command":"/bin/web","priority":1.5}}}`, "programs.web.priority: expect integer or string but got number"},
+		{"invalid boolean", `{"programs":{"web":{"command":"/bin/web","autostart":"maybe"}}}`, `programs.web.autostart: invalid value "maybe"`},
+		{"invalid duration", `{"programs":{"web":{"command":"/bin/web","stopwaitsecs":"soon"}}}`, `programs.web.stopwaitsecs: invalid value "soon"`},
+		{"group without programs", `{"groups":{"services":{}}}`, "groups.services.programs: required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseJSON([]byte(tt.json))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("parseJSON(%s) = %v, want no error", tt.json, err)
+				}
+				return
+			}
+			var errs SchemaErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("parseJSON(%s) = %v, want SchemaErrors", tt.json, err)
+			}
+			if got := errs.Error(); got != tt.want {
+				t.Errorf("parseJSON(%s) = %q, want %q", tt.json, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LogLevel the verbosity level of a message of loading the configuration
+type LogLevel int
+
+// the levels from the least to the most verbose
+const (
+	ErrorLevel LogLevel = iota
+	WarnLevel
+	InfoLevel
+	DebugLevel
+)
+
+// String returns the name of the level, e.g. "warning"
+func (l LogLevel) String() string {
+	switch l {
+	case ErrorLevel:
+		return "error"
+	case WarnLevel:
+		return "warning"
+	case InfoLevel:
+		return "info"
+	default:
+		return "debug"
+	}
+}
+
+// Fields the structured fields of a message, e.g. the section and the key
+type Fields map[string]interface{}
+
+// Logger receives the messages of loading the configuration, see SetLogger
+type Logger interface {
+	Log(level LogLevel, msg string, fields Fields)
+}
+
+// the default logger writing the messages to the standard logrus logger
+type logrusLogger struct{}
+
+// Log writes the message at the logrus level of level
+func (logrusLogger) Log(level LogLevel, msg string, fields Fields) {
+	levels := map[LogLevel]log.Level{ErrorLevel: log.ErrorLevel, WarnLevel: log.WarnLevel, InfoLevel: log.InfoLevel, DebugLevel: log.DebugLevel}
+	log.WithFields(log.Fields(fields)).Log(levels[level], msg)
+}
+
+// Warning a warning or an error logged while loading the configuration
+type Warning struct {
+	Level  LogLevel
+	Msg    string
+	Fields Fields
+}
+
+// String returns the message followed by the fields sorted by name, e.g.
+// "unknown configuration key key=autorstart section=program:web"
+func (w Warning) String() string {
+	keys := make([]string, 0, len(w.Fields))
+	for key := range w.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf strings.Builder
+	buf.WriteString(w.Msg)
+	for _, key := range keys {
+		fmt.Fprintf(&buf, " %s=%v", key, w.Fields[key])
+	}
+	return buf.String()
+}
+
+// the logger of a loading, it is used by the goroutines loading the files
+// concurrently. The messages are buffered and sent to the Logger by flush
+// once the configuration is unlocked, so the Logger may read the
+// configuration, and the warnings and the errors are collected
+type loadLogger struct {
+	lock     sync.Mutex
+	logger   Logger
+	records  []Warning
+	warnings []Warning
+}
+
+func newLoadLogger(logger Logger) *loadLogger {
+	if logger == nil {
+		logger = logrusLogger{}
+	}
+	return &loadLogger{logger: logger, records: make([]Warning, 0), warnings: make([]Warning, 0)}
+}
+
+// buffer the message and collect it if it is a warning or an error
+func (l *loadLogger) log(level LogLevel, msg string, fields Fields) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	record := Warning{Level: level, Msg: msg, Fields: fields}
+	l.records = append(l.records, record)
+	if level <= WarnLevel {
+		l.warnings = append(l.warnings, record)
+	}
+}
+
+// get the warnings and the errors collected
+func (l *loadLogger) getWarnings() []Warning {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append(make([]Warning, 0, len(l.warnings)), l.warnings...)
+}
+
+// send the buffered messages to the Logger in order
+func (l *loadLogger) flush() {
+	l.lock.Lock()
+	records := l.records
+	l.records = make([]Warning, 0)
+	l.lock.Unlock()
+	for _, record := range records {
+		l.logger.Log(record.Level, record.Msg, record.Fields)
+	}
+}
+
+// the logger of a configuration shared by its entries. The messages of
+// reading the entries go to the running loading if there is one, and to the
+// Logger otherwise
+type configLogs struct {
+	sync.RWMutex
+	logger  Logger
+	loading *loadLogger
+}
+
+// get the Logger, nil for the standard logrus logger
+func (l *configLogs) getLogger() Logger {
+	l.RLock()
+	defer l.RUnlock()
+	return l.logger
+}
+
+// start a loading logging to the Logger
+func (l *configLogs) startLoading() *loadLogger {
+	l.Lock()
+	defer l.Unlock()
+	l.loading = newLoadLogger(l.logger)
+	return l.loading
+}
+
+// end the running loading, the messages of reading the entries go to the
+// Logger again
+func (l *configLogs) endLoading() {
+	l.Lock()
+	defer l.Unlock()
+	l.loading = nil
+}
+
+// log the message of reading an entry
+func (l *configLogs) log(level LogLevel, msg string, fields Fields) {
+	l.RLock()
+	logger, loading := l.logger, l.loading
+	l.RUnlock()
+	if loading != nil {
+		loading.log(level, msg, fields)
+		return
+	}
+	if logger == nil {
+		logger = logrusLogger{}
+	}
+	logger.Log(level, msg, fields)
+}
+
+// log the message of reading the entry to the logger of its configuration,
+// or to the standard logrus logger if the entry doesn't belong to one
+func (c *Entry) log(level LogLevel, msg string, fields Fields) {
+	if c.logs == nil {
+		logrusLogger{}.Log(level, msg, fields)
+		return
+	}
+	c.logs.log(level, msg, fields)
+}
+
+// SetLogger sets the logger of the messages of loading and reading the
+// configuration, the messages are written to the standard logrus logger by
+// default.
+//
+// The messages of a loading are sent once the loading is complete and the
+// configuration is unlocked, so the logger may read the configuration
+func (c *Config) SetLogger(logger Logger) {
+	c.logs.Lock()
+	defer c.logs.Unlock()
+	c.logs.logger = logger
+}
+
+// Warnings returns the warnings and the errors logged by the last loading of
+// the configuration in order, e.g. the unknown keys and the invalid include
+// patterns, so they can be presented to the user reloading the configuration
+// rather than only written to the log. The warnings of the Watcher watching
+// the files of the loaded configuration follow them
+func (c *Config) Warnings() []Warning {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append(make([]Warning, 0, len(c.warnings)), c.warnings...)
+}
+
+// add the warning found after the loading to Warnings and send it to the
+// Logger, the lock must not be held
+func (c *Config) warn(msg string, fields Fields) {
+	c.lock.Lock()
+	c.warnings = append(c.warnings, Warning{Level: WarnLevel, Msg: msg, Fields: fields})
+	c.lock.Unlock()
+	logger := c.logs.getLogger()
+	if logger == nil {
+		logger = logrusLogger{}
+	}
+	logger.Log(WarnLevel, msg, fields)
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-envparse"
+	"github.com/ochinchina/go-ini"
+)
+
+// manifest the command and the environment contributed by the "manifest" file
+// of a program
+type manifest struct {
+	Command     string            `json:"command"`
+	Args        []string          `json:"args"`
+	Environment map[string]string `json:"environment"`
+}
+
+// read the manifest file, the ".json" files are decoded as manifest and the
+// other files are parsed as env files with the "command" key
+func readManifest(file string) (*manifest, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	result := &manifest{}
+	if isJSONFile(file) {
+		decoder := json.NewDecoder(bytes.NewReader(b))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(result); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return result, nil
+	}
+	env, err := envparse.Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	result.Command = env["command"]
+	delete(env, "command")
+	result.Environment = env
+	return result, nil
+}
+
+// quote the argument for the command line if it has spaces or quotes
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// format the environment to the "environment" value, the values are quoted so
+// they can contain any char
+func formatEnvironment(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+quoteEnvValue(env[key]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// apply the "manifest" files of the program and event listener sections. The
+// manifest is relative to the file of the section, the "command" of the
+// section overrides the command of the manifest, and the "environment" of the
+// section overrides the same variables of the manifest
+func (c *Config) applyManifests(cfg *ini.Ini) {
+	c.manifests = make([]string, 0)
+	for _, section := range cfg.Sections() {
+		if ok, _ := c.isProgramOrEventListener(section); !ok || !section.HasKey("manifest") {
+			continue
+		}
+		file := unquoteValue(strings.TrimSpace(section.GetValueWithDefault("manifest", "")))
+		if !isAbsConfigPath(file) {
+			location, ok := c.locations[section.Name]["manifest"]
+			if !ok {
+				location = c.locations[section.Name][""]
+			}
+			dir := c.configFileDir()
+			if location.file != "" {
+				dir = sourceDir(location.file)
+			}
+			if isRemoteFile(dir) {
+				c.addProblem(section.Name, "manifest", "the manifest of a remote configuration file is not supported")
+				continue
+			}
+			file = joinConfigPath(dir, file)
+		}
+		c.manifests = append(c.manifests, file)
+		m, err := readManifest(file)
+		if err != nil {
+			c.addProblem(section.Name, "manifest", err.Error())
+			continue
+		}
+		if !section.HasKey("command") && m.Command != "" {
+			args := []string{m.Command}
+			for _, arg := range m.Args {
+				args = append(args, quoteArg(arg))
+			}
+			section.Add("command", strings.Join(args, " "))
+		}
+		if len(m.Environment) > 0 {
+			env := formatEnvironment(m.Environment)
+			if value := unquoteValue(strings.TrimSpace(section.GetValueWithDefault("environment", ""))); value != "" {
+				env += "," + value
+			}
+			section.Add("environment", env)
+		}
+	}
+}
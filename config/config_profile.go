@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"regexp"
+
+	"github.com/ochinchina/go-ini"
+)
+
+// ProfileEnv the environment variable of the profile loaded if no profile is
+// set by SetProfile
+const ProfileEnv = "ZSSLD_PROFILE"
+
+// the profile sections, e.g. [program:web@prod]
+var profileSectionPattern = regexp.MustCompile(`^(.+)@([A-Za-z0-9_.-]+)$`)
+
+// SetProfile sets the profile of the configuration, e.g. "prod" for the
+// --profile switch. The keys of the [x@profile] sections of the profile
+// override the keys of the [x] sections, or make up the [x] sections if they
+// are not declared, and the sections of the other profiles are ignored:
+//
+//	[program:web]
+//	command=/usr/bin/web --debug
+//
+//	[program:web@prod]
+//	command=/usr/bin/web
+//	numprocs=4
+//
+// The profile is read from ProfileEnv if not set, and the sections of all the
+// profiles are ignored if there is no profile. A [x@y] section is a profile
+// section only if y is the loaded profile or the profile of a section
+// overriding a declared section, the other sections with "@" in their names
+// like [program:getty@tty1] are loaded as they are
+func (c *Config) SetProfile(profile string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.profile = profile
+}
+
+// GetProfile returns the profile of the configuration set by SetProfile or
+// read from ProfileEnv
+func (c *Config) GetProfile() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.getProfile()
+}
+
+// the profile of the configuration, the lock must be held
+func (c *Config) getProfile() string {
+	if c.profile != "" {
+		return c.profile
+	}
+	return os.Getenv(ProfileEnv)
+}
+
+// the profiles of the [x@profile] sections of cfg: the loaded profile and the
+// profiles of the sections overriding a declared [x] section. The [x@y]
+// sections of the other names are plain sections, e.g. [program:getty@tty1]
+func declaredProfiles(cfg *ini.Ini, profile string) map[string]bool {
+	result := make(map[string]bool)
+	if profile != "" {
+		result[profile] = true
+	}
+	for _, section := range cfg.Sections() {
+		if match := profileSectionPattern.FindStringSubmatch(section.Name); match != nil && cfg.HasSection(match[1]) {
+			result[match[2]] = true
+		}
+	}
+	return result
+}
+
+// merge the [x@profile] sections of cfg into the [x] sections and drop the
+// sections of the other profiles, the dropped sections are logged. The
+// declaration order of the [x] section is kept if it is declared, and the
+// locations of the keys of the profile sections override the locations of the
+// same keys
+func applyProfile(cfg *ini.Ini, profile string, sectionOrder map[string]int, locations map[string]map[string]keyLocation, logger *loadLogger) *ini.Ini {
+	profiles := declaredProfiles(cfg, profile)
+	profileSection := func(name string) []string {
+		if match := profileSectionPattern.FindStringSubmatch(name); match != nil && profiles[match[2]] {
+			return match
+		}
+		return nil
+	}
+	result := ini.NewIni()
+	for _, section := range cfg.Sections() {
+		if profileSection(section.Name) == nil {
+			target := result.NewSection(section.Name)
+			for _, key := range section.Keys() {
+				target.Add(key.Name(), key.ValueWithDefault(""))
+			}
+		}
+	}
+	for _, section := range cfg.Sections() {
+		match := profileSection(section.Name)
+		if match == nil {
+			continue
+		}
+		if match[2] != profile {
+			location := locations[section.Name][""]
+			logger.log(InfoLevel, "the section of another profile is ignored", Fields{
+				"section": section.Name,
+				"profile": profile,
+				"file":    location.file,
+				"line":    location.line,
+			})
+		}
+		if name := match[1]; match[2] == profile {
+			target := result.NewSection(name)
+			for _, key := range section.Keys() {
+				target.Add(key.Name(), key.ValueWithDefault(""))
+			}
+			if order, ok := sectionOrder[section.Name]; ok {
+				if _, found := sectionOrder[name]; !found {
+					sectionOrder[name] = order
+				}
+			}
+			if _, ok := locations[name]; !ok {
+				locations[name] = make(map[string]keyLocation)
+			}
+			for key, location := range locations[section.Name] {
+				if _, found := locations[name][key]; key != "" || !found {
+					locations[name][key] = location
+				}
+			}
+		}
+		delete(sectionOrder, section.Name)
+		delete(locations, section.Name)
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// the timeout of fetching a remote configuration file if not set in RemoteOptions
+const defaultRemoteTimeout = 30 * time.Second
+
+// MaxRemoteFileSize the maximum size of a remote configuration file, the
+// loading fails if a file is larger so a misbehaving server can't exhaust the
+// memory
+const MaxRemoteFileSize = 4 * 1024 * 1024
+
+// RemoteOptions the options of fetching the http and https configuration files
+type RemoteOptions struct {
+	// the timeout of fetching a file, defaultRemoteTimeout if zero
+	Timeout time.Duration
+	// the PEM encoded TLS client certificate and key files, no client
+	// certificate is sent if CertFile is empty
+	CertFile string
+	KeyFile  string
+	// the PEM encoded CA certificates file to verify the server, the system
+	// CA certificates are used if empty
+	CAFile string
+}
+
+// check if the configuration file is a http or https URL
+func isRemoteFile(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://")
+}
+
+// resolve the include file f relative to the remote directory here
+func resolveRemoteFile(here string, f string) (string, error) {
+	if strings.ContainsAny(f, "*?[") {
+		return "", fmt.Errorf("wildcards are not supported in remote include file %s", f)
+	}
+	base, err := url.Parse(strings.TrimSuffix(here, "/") + "/")
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(f)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// SetRemoteOptions sets the options of fetching the configuration file and
+// the include files which are http or https URLs
+func (c *Config) SetRemoteOptions(options RemoteOptions) error {
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultRemoteTimeout
+	}
+	tlsConfig := &tls.Config{}
+	if options.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if options.CAFile != "" {
+		b, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("no certificate is found in %s", options.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.httpClient = &http.Client{Timeout: timeout, Transport: transport}
+	return nil
+}
+
+// fetch the remote configuration file, the cached source is reused if the
+// server reports the file is not modified since the cached ETag
+func (c *Config) loadRemoteSource(ctx context.Context, file string, cached *configSource) (*configSource, error) {
+	c.lock.RLock()
+	client := c.httpClient
+	c.lock.RUnlock()
+	if client == nil {
+		client = &http.Client{Timeout: defaultRemoteTimeout}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if cached != nil && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", file, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, MaxRemoteFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(b) > MaxRemoteFileSize {
+		return nil, fmt.Errorf("%s: the file is larger than %d bytes", file, MaxRemoteFileSize)
+	}
+	name := file
+	if u, err := url.Parse(file); err == nil {
+		name = u.Path
+	}
+	return c.parseSource(file, name, b, &configSource{etag: resp.Header.Get("ETag")}, cached)
+}
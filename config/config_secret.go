@@ -0,0 +1,187 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-envparse"
+	"github.com/lettered/zssld-tools/faults"
+)
+
+// SecretResolver resolves the secret references in the environment values,
+// e.g. "{{vault:secret/data/app#password}}"
+type SecretResolver interface {
+	// Resolve returns the secret of the reference without the scheme and the
+	// braces, e.g. "secret/data/app#password"
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// the secret references, "{{scheme:ref}}"
+var secretRefPattern = regexp.MustCompile(`\{\{([a-zA-Z][a-zA-Z0-9_-]*):([^{}]*)\}\}`)
+
+// the secret resolvers by scheme
+var secretResolvers = struct {
+	sync.RWMutex
+	m map[string]SecretResolver
+}{m: map[string]SecretResolver{
+	"file":  FileSecretResolver{},
+	"vault": &VaultSecretResolver{},
+}}
+
+// RegisterSecretResolver registers the resolver of the secret references with
+// the scheme, the "file" and "vault" resolvers are registered by default
+func RegisterSecretResolver(scheme string, resolver SecretResolver) {
+	secretResolvers.Lock()
+	defer secretResolvers.Unlock()
+	secretResolvers.m[scheme] = resolver
+}
+
+// ResolveSecrets replaces the secret references "{{scheme:ref}}" in s with the
+// secrets returned by the resolvers registered with the schemes
+func ResolveSecrets(ctx context.Context, s string) (string, error) {
+	var resolveErr error
+	result := secretRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if resolveErr != nil {
+			return ref
+		}
+		m := secretRefPattern.FindStringSubmatch(ref)
+		secretResolvers.RLock()
+		resolver, ok := secretResolvers.m[m[1]]
+		secretResolvers.RUnlock()
+		if !ok {
+			resolveErr = faults.NewFault(faults.BadName, fmt.Sprintf("no secret resolver of %s", m[1]))
+			return ref
+		}
+		secret, err := resolver.Resolve(ctx, strings.TrimSpace(m[2]))
+		if err != nil {
+			resolveErr = fmt.Errorf("%s: %w", ref, err)
+			return ref
+		}
+		return secret
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return result, nil
+}
+
+// ResolveEnv returns the environment of the key like GetEnv with the secret
+// references in the values resolved, it is called when the program is started
+// so the secrets are not kept in the configuration
+func (c *Entry) ResolveEnv(ctx context.Context, key string) ([]string, error) {
+	envs := c.GetEnv(key)
+	for i, env := range envs {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) != 2 || !secretRefPattern.MatchString(kv[1]) {
+			continue
+		}
+		value, err := ResolveSecrets(ctx, kv[1])
+		if err != nil {
+			return nil, err
+		}
+		envs[i] = kv[0] + "=" + value
+	}
+	return envs, nil
+}
+
+// FileSecretResolver reads the secret from a file, "{{file:/path}}" is the
+// content of the file without the trailing line break and "{{file:/path#key}}"
+// is the value of key in the file of "KEY=value" lines
+type FileSecretResolver struct {
+}
+
+// Resolve reads the secret of the file reference
+func (r FileSecretResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	file, key, hasKey := strings.Cut(ref, "#")
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", faults.NewFault(faults.NoFile, err.Error())
+	}
+	if !hasKey {
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	envs, err := envparse.Parse(bytes.NewReader(b))
+	if err != nil {
+		return "", faults.NewFault(faults.BadArguments, err.Error())
+	}
+	value, ok := envs[key]
+	if !ok {
+		return "", faults.NewFault(faults.BadName, fmt.Sprintf("no %s in %s", key, file))
+	}
+	return value, nil
+}
+
+// VaultSecretResolver reads the secret field from the HashiCorp Vault KV secrets
+// engine, e.g. "{{vault:secret/data/app#password}}". Both version 1 and version 2
+// of the engine are supported
+type VaultSecretResolver struct {
+	// the address of the vault server, VAULT_ADDR if empty
+	Addr string
+	// the vault token, VAULT_TOKEN if empty
+	Token string
+	// the http client, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// Resolve reads the field of the vault secret
+func (r *VaultSecretResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || field == "" {
+		return "", faults.NewFault(faults.BadArguments, fmt.Sprintf("no field in vault secret %s", ref))
+	}
+	addr, token, client := r.Addr, r.Token, r.Client
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if addr == "" {
+		return "", faults.NewFault(faults.BadArguments, "the vault address is not set")
+	}
+	url := strings.TrimSuffix(addr, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", faults.NewFault(faults.BadArguments, err.Error())
+	}
+	req.Header.Set("X-Vault-Token", token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", faults.NewFault(faults.Failed, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", faults.NewFault(faults.Failed, fmt.Sprintf("vault secret %s: %s", path, resp.Status))
+	}
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", faults.NewFault(faults.Failed, err.Error())
+	}
+	data := secret.Data
+	// the version 2 engine puts the fields in data.data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = inner
+		}
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", faults.NewFault(faults.BadName, fmt.Sprintf("no %s in vault secret %s", field, path))
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,82 @@
+package config
+
+// copy the entry with its own key values and caches
+func (c *Entry) clone() *Entry {
+	result := NewEntry(c.ConfigDir)
+	result.Group = c.Group
+	result.Name = c.Name
+	result.section = c.section
+	c.cacheLock.Lock()
+	result.locations = c.locations
+	c.cacheLock.Unlock()
+	result.childLogDir = c.childLogDir
+	result.identifier = c.identifier
+	result.access, result.logs = c.access, c.logs
+	c.keyLock.RLock()
+	for key, value := range c.keyValues {
+		result.keyValues[key] = value
+	}
+	for key := range c.modified {
+		result.modified[key] = true
+	}
+	c.keyLock.RUnlock()
+	return result
+}
+
+// Snapshot returns a read-only copy of the loaded configuration. The snapshot
+// is not changed by the later loading or Entry.SetString of the configuration,
+// so it can be read by other goroutines, e.g. the RPC handlers, while the
+// configuration is reloaded:
+//
+//	c.Reload()
+//	current.Store(c.Snapshot())
+//
+// The snapshot can't be loaded and Entry.SetString of its entries is ignored
+func (c *Config) Snapshot() *Config {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	result := &Config{configFile: c.configFile,
+		configDir:    c.configDir,
+		overlayFiles: append([]string(nil), c.overlayFiles...),
+		built:        c.built,
+		entries:      make(map[string]*Entry, len(c.entries)),
+		programs:     make(map[string]*Entry, len(c.programs)),
+		groups:       make(map[string][]*Entry, len(c.groups)),
+		// the sources, section orders and locations are replaced rather than
+		// changed by loading
+		sources:      c.sources,
+		files:        append([]string(nil), c.files...),
+		sectionOrder: c.sectionOrder,
+		locations:    c.locations,
+		includeDirs:  append([]string(nil), c.includeDirs...),
+		manifests:    append([]string(nil), c.manifests...),
+		httpClient:   c.httpClient,
+		problems:     append([]ValidationError(nil), c.problems...),
+		access:       c.access,
+		logs:         &configLogs{logger: c.logs.getLogger()},
+		warnings:     append([]Warning(nil), c.warnings...),
+		bundle:       c.bundle,
+		strict:       c.strict,
+		compat:       c.compat,
+		profile:      c.getProfile(),
+		generation:   c.generation,
+		snapshot:     true}
+	clones := make(map[*Entry]*Entry, len(c.entries))
+	for name, entry := range c.entries {
+		clones[entry] = entry.clone()
+		clones[entry].readOnly = true
+		clones[entry].logs = result.logs
+		result.entries[name] = clones[entry]
+	}
+	for name, entry := range c.programs {
+		result.programs[name] = clones[entry]
+	}
+	for name, members := range c.groups {
+		entries := make([]*Entry, 0, len(members))
+		for _, member := range members {
+			entries = append(entries, clones[member])
+		}
+		result.groups[name] = entries
+	}
+	return result
+}
@@ -0,0 +1,381 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ochinchina/go-ini"
+)
+
+// maximum number of include files loaded concurrently
+const includeLoadConcurrency = 16
+
+// configSource a loaded configuration file, kept to skip reparsing the file
+// on reload if it is not changed
+type configSource struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+	// the ETag of the remote file
+	etag string
+	// the content of the file
+	content []byte
+	ini     *ini.Ini
+	// the declaration order of the sections and the lines of the keys
+	index *sourceIndex
+}
+
+// sourceIndex the declaration order of the sections and the lines of the keys
+// in a configuration file
+type sourceIndex struct {
+	sections []string
+	// the line numbers by the section name and the key, the line of the
+	// section header is keyed by ""
+	lines map[string]map[string]int
+}
+
+func newSourceIndex() *sourceIndex {
+	return &sourceIndex{sections: make([]string, 0), lines: make(map[string]map[string]int)}
+}
+
+// record the line of the key in the section, the key is "" for the section
+// header. The last line of a repeated key is kept as its value is the last one
+func (s *sourceIndex) add(section string, key string, line int) {
+	keys, ok := s.lines[section]
+	if !ok {
+		keys = make(map[string]int)
+		s.lines[section] = keys
+		s.sections = append(s.sections, section)
+	}
+	if _, found := keys[key]; key != "" || !found {
+		keys[key] = line
+	}
+}
+
+// keyLocation the file and the line a key is defined at
+type keyLocation struct {
+	file string
+	line int
+}
+
+// get the declaration order of the sections and the locations of the keys in
+// the files merged in order, the keys in the later files override the keys in
+// the earlier files and the first header of a section is kept
+func indexSources(files []string, sources map[string]*configSource) (map[string]int, map[string]map[string]keyLocation) {
+	sectionOrder := make(map[string]int)
+	locations := make(map[string]map[string]keyLocation)
+	for _, f := range files {
+		index := sources[f].index
+		if index == nil {
+			continue
+		}
+		for _, name := range index.sections {
+			if _, ok := sectionOrder[name]; !ok {
+				sectionOrder[name] = len(sectionOrder)
+				locations[name] = make(map[string]keyLocation)
+			}
+			for key, line := range index.lines[name] {
+				if _, found := locations[name][key]; key != "" || !found {
+					locations[name][key] = keyLocation{file: f, line: line}
+				}
+			}
+		}
+	}
+	return sectionOrder, locations
+}
+
+// load the configuration file, the cached source is reused if the file is not changed.
+//
+// The file is parsed as yaml if it has ".yaml" or ".yml" extension, as json validated
+// against the json schema if it has ".json" extension, otherwise as ini
+func (c *Config) loadSource(ctx context.Context, file string, cached *configSource) (*configSource, error) {
+	if isRemoteFile(file) {
+		return c.loadRemoteSource(ctx, file, cached)
+	}
+	fileInfo, err := os.Stat(file)
+	if err != nil {
+		return &configSource{ini: ini.NewIni()}, nil
+	}
+	if cached != nil && cached.modTime.Equal(fileInfo.ModTime()) && cached.size == fileInfo.Size() {
+		return cached, nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return &configSource{ini: ini.NewIni()}, nil
+	}
+	return c.parseSource(file, file, b, &configSource{modTime: fileInfo.ModTime(), size: fileInfo.Size()}, cached)
+}
+
+// parse the content b of the configuration file to source by the extension of
+// name, the ini of the cached source is reused if the content is not changed
+func (c *Config) parseSource(file string, name string, b []byte, source *configSource, cached *configSource) (*configSource, error) {
+	var err error
+	source.hash = sha256.Sum256(b)
+	source.content = b
+	if cached != nil && cached.hash == source.hash {
+		source.ini = cached.ini
+		source.index = cached.index
+		return source, nil
+	}
+	c.loading.log(InfoLevel, "load configuration from file", Fields{"file": file})
+	switch {
+	case isYamlFile(name):
+		source.ini, source.index, err = parseYaml(b)
+	case isJSONFile(name):
+		source.ini, source.index, err = parseJSON(b)
+	default:
+		lines := scanIniLines(b)
+		source.ini = ini.NewIni()
+		source.ini.LoadBytes(protectQuotedComments(lines))
+		source.index = newSourceIndex()
+		for _, line := range lines {
+			if line.isSection {
+				source.index.add(line.section, "", line.num)
+			} else if line.key != "" && line.section != "" {
+				source.index.add(line.section, line.key, line.num)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return source, nil
+}
+
+// join the ini lines back with the ";" and "#" in the quoted parts of the values
+// escaped, so the ini loader only strips the inline comments outside the quotes:
+//
+//	command=/bin/sh -c "echo a ; echo b" ; run the shell
+//
+// The quotes are kept in the values, and the """ multiline values are not changed
+func protectQuotedComments(lines []iniLine) []byte {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		text := strings.Join(line.lines, "\n")
+		if line.key != "" {
+			pos := strings.IndexAny(text, "=:") + 1
+			if value := strings.TrimSpace(text[pos:]); !strings.HasPrefix(value, `"""`) {
+				value = text[pos:]
+				if windowsPaths {
+					value = escapeWindowsPaths(value)
+				}
+				text = text[:pos] + escapeQuotedComments(value)
+			}
+		}
+		buf.WriteString(text)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// the Windows paths in the values are taken literally, only on Windows since
+// "\\" escapes a backslash in the values on the other systems, e.g. printf \\n
+var windowsPaths = runtime.GOOS == "windows"
+
+// check if a Windows path with a drive letter, e.g. C:\app, or a UNC path,
+// e.g. \\server\share, starts at s[i] at the beginning of a word
+func isWindowsPathStart(s string, i int) bool {
+	if i+2 >= len(s) || (i > 0 && strings.IndexByte(" \t\n=,\"'", s[i-1]) == -1) {
+		return false
+	}
+	ch := s[i] | 0x20
+	if ch >= 'a' && ch <= 'z' && s[i+1] == ':' && s[i+2] == '\\' {
+		return true
+	}
+	return s[i] == '\\' && s[i+1] == '\\' && s[i+2] != '\\' && !unicode.IsSpace(rune(s[i+2]))
+}
+
+// escape the single backslashes in the Windows paths of s, so the ini loader
+// takes them literally, e.g. C:\new is not C: and a new line. A path ends at a
+// space or a ",", or at the closing quote if it is quoted. The backslashes
+// already escaped in the path are kept
+func escapeWindowsPaths(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); {
+		if !isWindowsPathStart(s, i) {
+			buf.WriteByte(s[i])
+			i++
+			continue
+		}
+		quote := byte(0)
+		if i > 0 && (s[i-1] == '"' || s[i-1] == '\'') {
+			quote = s[i-1]
+		}
+		if s[i] == '\\' {
+			// the UNC prefix
+			buf.WriteString(`\\\\`)
+			i += 2
+		}
+		for ; i < len(s); i++ {
+			ch := s[i]
+			if (quote != 0 && ch == quote) || (quote == 0 && (unicode.IsSpace(rune(ch)) || ch == ',')) {
+				break
+			}
+			if ch == '\\' {
+				buf.WriteString(`\\`)
+				if i+1 < len(s) && s[i+1] == '\\' {
+					i++
+				}
+				continue
+			}
+			buf.WriteByte(ch)
+		}
+	}
+	return buf.String()
+}
+
+// escape the ";" and "#" between the quotes of s. A quote starts a quoted part
+// only at the beginning of a word, e.g. -c 'a ; b' or A="a ; b", and
+// the quote without the closing one is taken as it is
+func escapeQuotedComments(s string) string {
+	var buf strings.Builder
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\\' && i+1 < len(s):
+			// the escaped char is kept as it is
+			buf.WriteByte(ch)
+			i++
+			ch = s[i]
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			} else if ch == ';' || ch == '#' {
+				buf.WriteByte('\\')
+			}
+		case (ch == '"' || ch == '\'') && (i == 0 || strings.IndexByte(" \t\n=,", s[i-1]) != -1) && closingQuote(s, i) != -1:
+			quote = ch
+		}
+		buf.WriteByte(ch)
+	}
+	return buf.String()
+}
+
+// the index of the quote closing the quote at s[pos], -1 if not found
+func closingQuote(s string, pos int) int {
+	for i := pos + 1; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == s[pos] {
+			return i
+		}
+	}
+	return -1
+}
+
+// load the files concurrently, the returned sources are in the same order as the files.
+//
+// No more file is loaded after ctx is done and the error of ctx is returned
+func (c *Config) loadSources(ctx context.Context, files []string) ([]*configSource, error) {
+	result := make([]*configSource, len(files))
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, includeLoadConcurrency)
+	var wg sync.WaitGroup
+	for i, f := range files {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+		wg.Add(1)
+		go func(i int, f string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result[i], errs[i] = c.loadSource(ctx, f, c.sources[f])
+		}(i, f)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// load the include files of the main file and the include files of the
+// included files recursively. The returned files are in the merging order,
+// each included file follows the file including it, and the files included
+// more than once are loaded and returned once. The include cycles are logged
+// and skipped
+func (c *Config) loadIncludes(ctx context.Context, mainFile string, mainSource *configSource) ([]string, map[string]*configSource, []string, error) {
+	sources := map[string]*configSource{mainFile: mainSource}
+	children := make(map[string][]string)
+	includeDirs := make([]string, 0)
+	pending := []string{mainFile}
+	for len(pending) > 0 {
+		next := make([]string, 0)
+		scheduled := make(map[string]bool)
+		for _, file := range pending {
+			files, dirs := c.getIncludeFiles(sources[file].ini, sourceDir(file))
+			children[file] = files
+			includeDirs = append(includeDirs, dirs...)
+			for _, f := range files {
+				if _, ok := sources[f]; !ok && !scheduled[f] {
+					scheduled[f] = true
+					next = append(next, f)
+				}
+			}
+		}
+		loaded, err := c.loadSources(ctx, next)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for i, source := range loaded {
+			sources[next[i]] = source
+		}
+		pending = next
+	}
+
+	result := make([]string, 0, len(sources))
+	merged := make(map[string]bool)
+	including := make(map[string]bool)
+	var visit func(file string)
+	visit = func(file string) {
+		including[file] = true
+		for _, f := range children[file] {
+			if including[f] {
+				c.loading.log(WarnLevel, "include cycle is skipped", Fields{"file": file, "include": f})
+				continue
+			}
+			if merged[f] {
+				continue
+			}
+			merged[f] = true
+			result = append(result, f)
+			visit(f)
+		}
+		including[file] = false
+	}
+	visit(mainFile)
+	return result, sources, includeDirs, nil
+}
+
+// merge all the sections of src into dst, the keys in src overwrite the same keys in dst
+func mergeIni(dst *ini.Ini, src *ini.Ini) {
+	for _, srcSection := range src.Sections() {
+		section := dst.NewSection(srcSection.Name)
+		for _, key := range srcSection.Keys() {
+			section.Add(key.Name(), key.ValueWithDefault(""))
+		}
+	}
+}
@@ -0,0 +1,818 @@
+package config
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ochinchina/go-ini"
+)
+
+func TestGetIncludeFiles(t *testing.T) {
+	here := t.TempDir()
+	confDir := filepath.Join(here, "conf.d")
+	if err := os.Mkdir(confDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"foo.ini", "foo.ini.bak", "10-web.ini", "web.conf", "2.ini.orig"} {
+		if err := os.WriteFile(filepath.Join(confDir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		files    string
+		want     []string
+		wantDirs []string
+	}{
+		{"suffix", "conf.d/*.ini", []string{"conf.d/10-web.ini", "conf.d/foo.ini"}, []string{"conf.d"}},
+		{"character class", "conf.d/[0-9]*.ini", []string{"conf.d/10-web.ini"}, []string{"conf.d"}},
+		{"several patterns", "conf.d/*.conf conf.d/foo.ini", []string{"conf.d/web.conf", "conf.d/foo.ini"}, []string{"conf.d"}},
+		{"here", "%(here)s/conf.d/*.conf", []string{"conf.d/web.conf"}, []string{"conf.d"}},
+		{"missing directory", "missing/*.ini", []string{}, []string{"missing"}},
+		{"no match", "conf.d/*.yaml", []string{}, []string{"conf.d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ini.NewIni()
+			cfg.NewSection("include").Add("files", tt.files)
+			c := NewConfig(filepath.Join(here, "zssld.conf"))
+			c.loading = newLoadLogger(nil)
+			got, dirs := c.getIncludeFiles(cfg, here)
+			want := make([]string, len(tt.want))
+			for i, f := range tt.want {
+				want[i] = filepath.Join(here, f)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("getIncludeFiles(%q) = %q, want %q", tt.files, got, want)
+			}
+			wantDirs := make([]string, len(tt.wantDirs))
+			for i, dir := range tt.wantDirs {
+				wantDirs[i] = filepath.Join(here, dir)
+			}
+			if !reflect.DeepEqual(dirs, wantDirs) {
+				t.Errorf("getIncludeFiles(%q) dirs = %q, want %q", tt.files, dirs, wantDirs)
+			}
+		})
+	}
+}
+
+func TestValidateProcesses(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "zssld.conf")
+	conf := "[program:web]\ncommand=/bin/web\nprocess_name=web_%(process_num)d\nnumprocs=3\nautorstart=true\n"
+	if err := os.WriteFile(file, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConfig(file)
+	if _, err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.GetPrograms()); n != 3 {
+		t.Fatalf("loaded %d processes, want 3", n)
+	}
+	errs := c.Validate()
+	if len(errs) != 1 || errs[0].Section != "program:web" || errs[0].Key != "autorstart" {
+		t.Errorf("Validate() = %v, want the unknown autorstart of program:web once", errs)
+	}
+}
+
+// write the tar.gz bundle with the files
+func writeBundle(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadBundle(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	bundle := filepath.Join(t.TempDir(), "zssld.tgz")
+	web := "[program:web]\ncommand=/bin/web\nprocess_name=web_%(process_num)d\nnumprocs=2\nnumprocs_start=1\nenvFiles=%(here)s/web.env\n"
+	writeBundle(t, bundle, map[string]string{
+		"zssld.conf": web + "[program:api]\ncommand=/bin/api\n",
+		"web.env":    "PORT=80\n",
+	})
+	c := NewConfig(bundle)
+	c.SetStrict(true)
+	if _, err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	here := c.GetConfigFileDir()
+
+	writeBundle(t, bundle, map[string]string{
+		"zssld.conf": web + "[program:api]\ncommand=/bin/api --verbose\n",
+		"web.env":    "PORT=80\n",
+	})
+	added, changed, removed, err := c.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 0 || !reflect.DeepEqual(changed, []string{"api"}) || len(removed) != 0 {
+		t.Errorf("Reload() = %v, %v, %v, want only api changed", added, changed, removed)
+	}
+	if dir := c.GetConfigFileDir(); dir != here {
+		t.Errorf("GetConfigFileDir() = %s after reload, want %s", dir, here)
+	}
+
+	// the rejected bundle leaves the loaded files in place
+	writeBundle(t, bundle, map[string]string{
+		"zssld.conf": web + "[program:api]\ncommand=/bin/api\nnumprocs=x\n",
+		"web.env":    "PORT=8080\n",
+	})
+	if _, _, _, err := c.Reload(); err == nil {
+		t.Fatal("Reload() of the invalid bundle succeeded")
+	}
+	if b, err := os.ReadFile(filepath.Join(here, "web.env")); err != nil || string(b) != "PORT=80\n" {
+		t.Errorf("web.env = %q, %v after the rejected reload, want the loaded one", b, err)
+	}
+	if command := c.GetProgram("api").GetString("command", ""); command != "/bin/api --verbose" {
+		t.Errorf("api command = %q after the rejected reload", command)
+	}
+}
+
+// the Logger recording the messages
+type recordLogger struct {
+	messages []Warning
+}
+
+func (l *recordLogger) Log(level LogLevel, msg string, fields Fields) {
+	l.messages = append(l.messages, Warning{Level: level, Msg: msg, Fields: fields})
+}
+
+func TestProfileSections(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "zssld.conf")
+	conf := `[program:getty@tty1]
+command=/sbin/agetty tty1
+
+[program:web]
+command=/bin/web --debug
+
+[program:web@prod]
+command=/bin/web
+
+[program:worker@prod]
+command=/bin/worker
+`
+	if err := os.WriteFile(file, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		profile string
+		want    []string
+		command string
+		ignored []string
+	}{
+		{"", []string{"getty@tty1", "web"}, "/bin/web --debug", []string{"program:web@prod", "program:worker@prod"}},
+		{"prod", []string{"getty@tty1", "web", "worker"}, "/bin/web", nil},
+		{"tty1", []string{"getty", "web"}, "/bin/web --debug", []string{"program:web@prod", "program:worker@prod"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			logger := &recordLogger{}
+			c := NewConfig(file)
+			c.SetProfile(tt.profile)
+			c.SetLogger(logger)
+			if _, err := c.Load(); err != nil {
+				t.Fatal(err)
+			}
+			got := c.GetProgramNames()
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetProgramNames() = %q, want %q", got, tt.want)
+			}
+			if command := c.GetProgram("web").GetString("command", ""); command != tt.command {
+				t.Errorf("web command = %q, want %q", command, tt.command)
+			}
+			var ignored []string
+			for _, message := range logger.messages {
+				if message.Msg == "the section of another profile is ignored" {
+					ignored = append(ignored, message.Fields["section"].(string))
+				}
+			}
+			sort.Strings(ignored)
+			if !reflect.DeepEqual(ignored, tt.ignored) {
+				t.Errorf("ignored sections %q, want %q", ignored, tt.ignored)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "zssld.conf")
+	conf := "[program:web]\ncommand=/bin/web --port 80%(process_num)d\nprocess_name=web_%(process_num)d\nnumprocs=2\nnumprocs_start=1\nstartretries=x\n"
+	if err := os.WriteFile(file, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Check(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ValidationError{{Section: "program:web", Key: "startretries", Msg: `invalid int value "x"`, File: file, Line: 6}}
+	if !reflect.DeepEqual(report.Problems, want) {
+		t.Errorf("Check() problems = %v, want %v", report.Problems, want)
+	}
+	if !reflect.DeepEqual(report.Programs, []string{"web_1", "web_2"}) {
+		t.Errorf("Check() programs = %q, want web_1 and web_2", report.Programs)
+	}
+	for _, line := range []string{"[program:web_2]\n", "command=/bin/web --port 802\n", "process_name=web_2\n"} {
+		if !strings.Contains(report.Effective, line) {
+			t.Errorf("Check() effective configuration doesn't contain %q:\n%s", line, report.Effective)
+		}
+	}
+}
+
+func TestBackslashValues(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "zssld.conf")
+	conf := "[program:web]\ncommand=printf \\\\n%s x\ndirectory=C:\\new\\app\n"
+	if err := os.WriteFile(file, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		windowsPaths bool
+		command      string
+		directory    string
+	}{
+		{"unix", false, `printf \n%s x`, "C:\new\app"},
+		{"windows", true, `printf \\n%s x`, `C:\new\app`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(old bool) { windowsPaths = old }(windowsPaths)
+			windowsPaths = tt.windowsPaths
+			c := NewConfig(file)
+			if _, err := c.Load(); err != nil {
+				t.Fatal(err)
+			}
+			web := c.GetProgram("web")
+			if command := web.GetString("command", ""); command != tt.command {
+				t.Errorf("command = %q, want %q", command, tt.command)
+			}
+			if directory := web.GetString("directory", ""); directory != tt.directory {
+				t.Errorf("directory = %q, want %q", directory, tt.directory)
+			}
+		})
+	}
+}
+
+func TestValidateLogfileValues(t *testing.T) {
+	tests := []struct {
+		name string
+		conf string
+		want []string
+	}{
+		{"valid", "stdout_logfile_maxbytes=1MB\nstdout_logfile_backups=3\n", nil},
+		{"negative backups", "stdout_logfile_backups=-1\n", []string{"stdout_logfile_backups: negative value -1"}},
+		{"negative maxbytes", "stderr_logfile_maxbytes=-1MB\n", []string{`stderr_logfile_maxbytes: invalid bytes value "-1MB"`}},
+		{"negative retries", "startretries=-3\n", []string{"startretries: negative value -3"}},
+		{"negative priority", "priority=-10\n", nil},
+		{"no backups", "stdout_logfile_maxbytes=1MB\nstdout_logfile_backups=0\n",
+			[]string{"stdout_logfile_backups: no backups with stdout_logfile_maxbytes set, the log file is truncated once it is full"}},
+		{"no backups without rotation", "stderr_logfile_maxbytes=0\nstderr_logfile_backups=0\n", nil},
+		{"deprecated no backups", "logfile_maxbytes=1MB\nlogfile_backups=0\n",
+			[]string{"stdout_logfile_backups: no backups with stdout_logfile_maxbytes set, the log file is truncated once it is full"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "zssld.conf")
+			if err := os.WriteFile(file, []byte("[program:web]\ncommand=/bin/web\n"+tt.conf), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			c := NewConfig(file)
+			if _, err := c.Load(); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, problem := range c.Validate() {
+				got = append(got, problem.Key+": "+problem.Msg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLogProps(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "zssld.conf")
+	conf := "[zssld]\nlogfile_rotate=hourly\n\n[program:web]\ncommand=/bin/web\nstdout_logfile_rotate=Daily\nstderr_logfile_rotate=monthly\nsyslog_tag=web\n"
+	if err := os.WriteFile(file, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConfig(file)
+	if _, err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	web := c.GetProgram("web")
+	if got, want := web.GetLogProps("stdout"), map[string]string{"syslog_tag": "web", "logfile_rotate": "daily"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetLogProps(stdout) = %v, want %v", got, want)
+	}
+	if got, want := web.GetLogProps("stderr"), map[string]string{"syslog_tag": "web", "logfile_rotate": "none"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetLogProps(stderr) = %v, want %v", got, want)
+	}
+	zssld, _ := c.GetZssld()
+	if got, want := zssld.GetLogProps(""), map[string]string{"logfile_rotate": "hourly"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetLogProps() of zssld = %v, want %v", got, want)
+	}
+	errs := c.Validate()
+	if len(errs) != 1 || errs[0].Key != "stderr_logfile_rotate" {
+		t.Errorf("Validate() = %v, want the invalid stderr_logfile_rotate", errs)
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"0", 0, false},
+		{"10b", 10, false},
+		{"512kb", 512 << 10, false},
+		{"512KB", 512 << 10, false},
+		{"1.5GB", 3 << 29, false},
+		{"2 TB", 2 << 40, false},
+		{"1GiB", 1 << 30, false},
+		{"50M", 50 << 20, false},
+		{" 1 mib ", 1 << 20, false},
+		{"0.5", 0, false},
+		{"9223372036854775807", 1<<63 - 1, false},
+		{"9223372036854775808", 0, true},
+		{"8388608TB", 0, true},
+		{"-1MB", 0, true},
+		{"MB", 0, true},
+		{"", 0, true},
+		{"1.5.5MB", 0, true},
+		{"10XB", 0, true},
+		{"1 G B", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseBytes(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBytes(%q) error %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseBytes(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+			entry := NewEntry("")
+			entry.keyValues["logfile_maxbytes"] = tt.value
+			want := tt.want
+			if tt.wantErr {
+				want = -1
+			}
+			if got := entry.GetBytes("logfile_maxbytes", -1); got != want {
+				t.Errorf("GetBytes(%q) = %d, want %d", tt.value, got, want)
+			}
+		})
+	}
+}
+
+func TestWatcherWarnings(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "zssld.conf")
+	if err := os.WriteFile(file, []byte("[program:web]\ncommand=/bin/web\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	logger := &recordLogger{}
+	c := NewConfig(file)
+	c.SetLogger(logger)
+	if _, err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(c, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the directories can't be watched by the closed watcher
+	w.Close()
+	for range w.Events() {
+	}
+	w.dirs = make(map[string]bool)
+	w.updateWatches()
+
+	warnings := c.Warnings()
+	if len(warnings) != 1 || warnings[0].Msg != "fail to watch the configuration directory" || warnings[0].Fields["dir"] != filepath.Dir(file) {
+		t.Errorf("Warnings() = %v, want the directory failed to watch", warnings)
+	}
+	if n := len(logger.messages); n == 0 || logger.messages[n-1].Msg != "fail to watch the configuration directory" {
+		t.Errorf("Logger messages %v, want the directory failed to watch", logger.messages)
+	}
+}
+
+func TestReloadContext(t *testing.T) {
+	var slow atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			<-r.Context().Done()
+			return
+		}
+		io.WriteString(w, "[program:api]\ncommand=/bin/api\n")
+	}))
+	defer server.Close()
+	file := filepath.Join(t.TempDir(), "zssld.conf")
+	conf := "[include]\nfiles=" + server.URL + "/api.conf\n\n[program:web]\ncommand=/bin/web\n"
+	if err := os.WriteFile(file, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConfig(file)
+	if _, err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	generation := c.Generation()
+
+	slow.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, _, err := c.ReloadContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ReloadContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if c.Generation() != generation || c.GetProgram("api") == nil {
+		t.Errorf("the configuration is changed by the abandoned reload")
+	}
+}
+
+func TestRemoteFileSizeLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size := MaxRemoteFileSize
+		if r.URL.Path == "/large.conf" {
+			size++
+		}
+		io.WriteString(w, "[program:web]\ncommand=/bin/web\n")
+		io.WriteString(w, strings.Repeat(";", size-len("[program:web]\ncommand=/bin/web\n")))
+	}))
+	defer server.Close()
+	if _, err := NewConfig(server.URL + "/max.conf").Load(); err != nil {
+		t.Errorf("Load() of the file of the maximum size: %v", err)
+	}
+	if _, err := NewConfig(server.URL + "/large.conf").Load(); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("Load() of the too large file = %v, want the size error", err)
+	}
+}
+
+// write the configuration file with conf and load it
+func loadTestConfig(t *testing.T, conf string) *Config {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "zssld.conf")
+	if err := os.WriteFile(file, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConfig(file)
+	if _, err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNumprocs(t *testing.T) {
+	c := loadTestConfig(t, `[program:web]
+command=/bin/web --port 80%(process_num)02d
+process_name=web_%(process_num)d
+numprocs=3
+stdout_logfile=/var/log/web-%(process_num)d.log
+`)
+	tests := []struct {
+		name    string
+		command string
+		logfile string
+	}{
+		{"web_1", "/bin/web --port 8001", "/var/log/web-1.log"},
+		{"web_2", "/bin/web --port 8002", "/var/log/web-2.log"},
+		{"web_3", "/bin/web --port 8003", "/var/log/web-3.log"},
+	}
+	if got := c.GetProgramNames(); len(got) != len(tests) {
+		t.Fatalf("GetProgramNames() = %q, want %d processes", got, len(tests))
+	}
+	for i, tt := range tests {
+		entry := c.GetProgram(tt.name)
+		if entry == nil {
+			t.Fatalf("no process %s", tt.name)
+		}
+		if got := entry.GetString("command", ""); got != tt.command {
+			t.Errorf("%s command = %q, want %q", tt.name, got, tt.command)
+		}
+		if got := entry.GetInt("process_num", 0); got != i+1 {
+			t.Errorf("%s process_num = %d, want %d", tt.name, got, i+1)
+		}
+		if got := entry.GetStringExpression("stdout_logfile", ""); got != tt.logfile {
+			t.Errorf("%s stdout_logfile = %q, want %q", tt.name, got, tt.logfile)
+		}
+	}
+	if errs := c.Validate(); len(errs) != 0 {
+		t.Errorf("Validate() = %v, want no problems", errs)
+	}
+}
+
+func TestNumprocsStart(t *testing.T) {
+	tests := []struct {
+		name  string
+		conf  string
+		want  []string
+		start int
+	}{
+		{"default", "numprocs=2\n", []string{"web_1", "web_2"}, 1},
+		{"offset", "numprocs=3\nnumprocs_start=8080\n", []string{"web_8080", "web_8081", "web_8082"}, 8080},
+		{"zero", "numprocs=2\nnumprocs_start=0\n", []string{"web_0", "web_1"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := loadTestConfig(t, "[program:web]\ncommand=/bin/web --port %(process_num)d\nprocess_name=web_%(process_num)d\n"+tt.conf)
+			got := c.GetProgramNames()
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("GetProgramNames() = %q, want %q", got, tt.want)
+			}
+			for i, name := range tt.want {
+				entry := c.GetProgram(name)
+				if start := entry.GetInt("numprocs_start", -1); start != tt.start {
+					t.Errorf("%s numprocs_start = %d, want %d", name, start, tt.start)
+				}
+				if command, want := entry.GetString("command", ""), fmt.Sprintf("/bin/web --port %d", tt.start+i); command != want {
+					t.Errorf("%s command = %q, want %q", name, command, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNestedGroups(t *testing.T) {
+	c := loadTestConfig(t, `[program:web]
+command=/bin/web
+process_name=web_%(process_num)d
+numprocs=2
+
+[program:api]
+command=/bin/api
+
+[program:worker]
+command=/bin/worker
+
+[program:cron]
+command=/bin/cron
+
+[group:frontend]
+programs=web,api
+
+[group:all]
+programs=group:frontend,worker,api,missing
+
+[group:loop]
+programs=cron,group:loop
+`)
+	groupPrograms := func(name string) []string {
+		names := make([]string, 0)
+		for _, entry := range c.GetGroupPrograms(name) {
+			names = append(names, entry.GetProgramName())
+		}
+		return names
+	}
+	tests := []struct {
+		group string
+		want  []string
+	}{
+		{"frontend", []string{"web_1", "web_2", "api"}},
+		{"all", []string{"web_1", "web_2", "api", "worker"}},
+		{"loop", []string{"cron"}},
+		{"unknown", []string{}},
+	}
+	for _, tt := range tests {
+		if got := groupPrograms(tt.group); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetGroupPrograms(%s) = %q, want %q", tt.group, got, tt.want)
+		}
+	}
+	// the processes are in the first group listing their program
+	for name, want := range map[string]string{"web_1": "frontend", "web_2": "frontend", "api": "frontend", "worker": "all", "cron": "loop"} {
+		if group := c.GetProgram(name).GetGroupName(); group != want {
+			t.Errorf("group of %s = %q, want %q", name, group, want)
+		}
+	}
+	var problems []string
+	for _, problem := range c.Validate() {
+		problems = append(problems, problem.Section+" "+problem.Key+": "+problem.Msg)
+	}
+	want := []string{"group:all programs: no program or group missing", "group:loop programs: group loop includes itself"}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("Validate() = %q, want %q", problems, want)
+	}
+}
+
+func TestReload(t *testing.T) {
+	base := "[program:web]\ncommand=/bin/web\nprocess_name=web_%(process_num)d\nnumprocs=2\n\n[program:api]\ncommand=/bin/api\n\n[include]\nfiles=conf.d/*.ini\n"
+	tests := []struct {
+		name        string
+		conf        string
+		include     string
+		wantAdded   []string
+		wantChanged []string
+		wantRemoved []string
+	}{
+		{"unchanged", base, "[program:worker]\ncommand=/bin/worker\n", nil, nil, nil},
+		{"changed", strings.Replace(base, "/bin/api", "/bin/api -v", 1), "[program:worker]\ncommand=/bin/worker\n", nil, []string{"api"}, nil},
+		{"more processes", strings.Replace(base, "numprocs=2", "numprocs=3", 1), "[program:worker]\ncommand=/bin/worker\n", []string{"web_3"}, []string{"web_1", "web_2"}, nil},
+		{"include changed", base, "[program:worker]\ncommand=/bin/worker -n 2\n", nil, []string{"worker"}, nil},
+		{"added and removed", base, "[program:cron]\ncommand=/bin/cron\n", []string{"cron"}, nil, []string{"worker"}},
+		{"group added", base + "[group:backend]\nprograms=api\n", "[program:worker]\ncommand=/bin/worker\n", nil, []string{"api"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			file, include := filepath.Join(dir, "zssld.conf"), filepath.Join(dir, "conf.d", "worker.ini")
+			if err := os.Mkdir(filepath.Dir(include), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			write := func(path, content string) {
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			write(file, base)
+			write(include, "[program:worker]\ncommand=/bin/worker\n")
+			c := NewConfig(file)
+			if _, err := c.Load(); err != nil {
+				t.Fatal(err)
+			}
+			old := c.GetProgram("web_1")
+
+			write(file, tt.conf)
+			write(include, tt.include)
+			added, changed, removed, err := c.Reload()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(added, tt.wantAdded) || !reflect.DeepEqual(changed, tt.wantChanged) || !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("Reload() = %q, %q, %q, want %q, %q, %q", added, changed, removed, tt.wantAdded, tt.wantChanged, tt.wantRemoved)
+			}
+			// the unchanged entries are kept
+			wantKept := true
+			for _, name := range tt.wantChanged {
+				wantKept = wantKept && name != "web_1"
+			}
+			if kept := c.GetProgram("web_1") == old; kept != wantKept {
+				t.Errorf("web_1 entry kept = %v, want %v", kept, wantKept)
+			}
+		})
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "zssld.conf")
+	if err := os.Mkdir(filepath.Join(dir, "conf.d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf := "[program:api]\ncommand=/bin/api\n\n[include]\nfiles=conf.d/*.ini\n"
+	write(file, conf)
+	c := NewConfig(file)
+	c.SetStrict(true)
+	if _, err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(c, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	next := func(timeout time.Duration) (WatchEvent, bool) {
+		select {
+		case event := <-w.Events():
+			return event, true
+		case <-time.After(timeout):
+			return WatchEvent{}, false
+		}
+	}
+
+	// the other files in the directory are not watched
+	write(filepath.Join(dir, "notes.txt"), "x")
+	if event, ok := next(300 * time.Millisecond); ok {
+		t.Fatalf("event %+v for the unrelated file", event)
+	}
+
+	// the changes within the debounce duration are reloaded at once
+	write(file, strings.Replace(conf, "/bin/api", "/bin/api -v", 1))
+	write(filepath.Join(dir, "conf.d", "worker.ini"), "[program:worker]\ncommand=/bin/worker\n")
+	event, ok := next(5 * time.Second)
+	if !ok {
+		t.Fatal("no event after the files are changed")
+	}
+	if event.Err != nil || !reflect.DeepEqual(event.Added, []string{"worker"}) || !reflect.DeepEqual(event.Changed, []string{"api"}) || len(event.Removed) != 0 {
+		t.Errorf("event %+v, want worker added and api changed", event)
+	}
+	if event, ok := next(300 * time.Millisecond); ok {
+		t.Errorf("second event %+v for the debounced changes", event)
+	}
+
+	// the invalid configuration is reported and not loaded
+	write(filepath.Join(dir, "conf.d", "worker.ini"), "[program:worker]\ncommand=/bin/worker\nnumprocs=x\n")
+	if event, ok = next(5 * time.Second); !ok || event.Err == nil {
+		t.Fatalf("event %+v, %v, want the reloading error", event, ok)
+	}
+	if c.GetProgram("worker") == nil {
+		t.Error("worker is removed by the failed reload")
+	}
+}
+
+func TestEncryptedValues(t *testing.T) {
+	// the master key is read from the environment in the tests
+	resetMasterKey := func() {
+		masterKey.Lock()
+		masterKey.key = nil
+		masterKey.Unlock()
+	}
+	resetMasterKey()
+	t.Cleanup(resetMasterKey)
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	if err := os.WriteFile(keyFile, []byte(key+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(MasterKeyEnv, key)
+	password, err := EncryptValue("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := EncryptValue("t0ken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(password, "ENC[") || strings.Contains(password, "s3cret") {
+		t.Fatalf("EncryptValue() = %q", password)
+	}
+	c := loadTestConfig(t, fmt.Sprintf("[inet_http_server]\nport=:9001\nusername=admin\npassword=%s\n\n[program:web]\ncommand=/bin/web\nenvironment=TOKEN=\"%s\",MODE=prod\n", password, token))
+
+	tests := []struct {
+		name     string
+		key      string
+		keyFile  string
+		password string
+		env      []string
+	}{
+		{"key", key, "", "s3cret", []string{"MODE=prod", "TOKEN=t0ken"}},
+		{"key file", "", keyFile, "s3cret", []string{"MODE=prod", "TOKEN=t0ken"}},
+		{"wrong key", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, 32)), "", "", []string{"MODE=prod"}},
+		{"no key", "", "", "", []string{"MODE=prod"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(MasterKeyEnv, tt.key)
+			t.Setenv(MasterKeyFileEnv, tt.keyFile)
+			server, _ := c.GetInetHTTPServer()
+			server.resetCache()
+			web := c.GetProgram("web")
+			web.resetCache()
+			if got := server.GetString("password", ""); got != tt.password {
+				t.Errorf("password = %q, want %q", got, tt.password)
+			}
+			if got := server.GetString("username", ""); got != "admin" {
+				t.Errorf("username = %q, want admin", got)
+			}
+			env := web.GetEnv("environment")
+			sort.Strings(env)
+			if !reflect.DeepEqual(env, tt.env) {
+				t.Errorf("environment = %q, want %q", env, tt.env)
+			}
+		})
+	}
+	if err := SetMasterKey([]byte("short")); err == nil {
+		t.Error("SetMasterKey() of the short key succeeded")
+	}
+}
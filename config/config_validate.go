@@ -0,0 +1,447 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lettered/zssld-tools/faults"
+)
+
+// ValidationError a problem found in the configuration
+type ValidationError struct {
+	// Section the name of the section, e.g. "program:web"
+	Section string
+	// Key the key with the problem, empty if the problem is about the whole section
+	Key string
+	// Msg describes the problem
+	Msg string
+	// File and Line the location of the key or the section, empty if unknown
+	File string
+	Line int
+}
+
+// Error returns the location, section, key and description of the problem
+func (e ValidationError) Error() string {
+	location := ""
+	if e.File != "" {
+		location = fmt.Sprintf("%s:%d: ", e.File, e.Line)
+	}
+	if e.Key == "" {
+		return fmt.Sprintf("%s[%s] %s", location, e.Section, e.Msg)
+	}
+	return fmt.Sprintf("%s[%s] %s: %s", location, e.Section, e.Key, e.Msg)
+}
+
+// ValidationErrors all the problems found in the configuration
+type ValidationErrors []ValidationError
+
+// Error returns all the problems separated by "; "
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// FaultCode returns the fault code of the configuration problems
+func (e ValidationErrors) FaultCode() faults.FaultCode {
+	return faults.BadArguments
+}
+
+// the type of the key value
+type keyType int
+
+const (
+	stringKey keyType = iota
+	intKey
+	// the int which can't be negative, e.g. the number of the backups
+	uintKey
+	boolKey
+	bytesKey
+	durationKey
+	autoRestartKey
+	cronKey
+	conditionKey
+	rotateKey
+)
+
+// the keys shared by programs and event listeners
+var programKeys = map[string]keyType{
+	"command":                            stringKey,
+	"process_name":                       stringKey,
+	"numprocs":                           uintKey,
+	"numprocs_start":                     uintKey,
+	"process_num":                        uintKey,
+	"priority":                           intKey,
+	"autostart":                          boolKey,
+	"startsecs":                          durationKey,
+	"startretries":                       uintKey,
+	"autorestart":                        autoRestartKey,
+	"exitcodes":                          stringKey,
+	"stopsignal":                         stringKey,
+	"stopwaitsecs":                       durationKey,
+	"stopasgroup":                        boolKey,
+	"killasgroup":                        boolKey,
+	"user":                               stringKey,
+	"use_template":                       stringKey,
+	"manifest":                           stringKey,
+	"redirect_stderr":                    boolKey,
+	"stdout_logfile":                     stringKey,
+	"stdout_logfile_maxbytes":            bytesKey,
+	"stdout_logfile_backups":             uintKey,
+	"stdout_logfile_rotate":              rotateKey,
+	"stdout_capture_maxbytes":            bytesKey,
+	"stdout_events_enabled":              boolKey,
+	"stdout_syslog":                      boolKey,
+	"stderr_logfile":                     stringKey,
+	"stderr_logfile_maxbytes":            bytesKey,
+	"stderr_logfile_backups":             uintKey,
+	"stderr_logfile_rotate":              rotateKey,
+	"stderr_capture_maxbytes":            bytesKey,
+	"stderr_events_enabled":              boolKey,
+	"stderr_syslog":                      boolKey,
+	"syslog_priority":                    stringKey,
+	"syslog_facility":                    stringKey,
+	"syslog_tag":                         stringKey,
+	"environment":                        stringKey,
+	"envFiles":                           stringKey,
+	"directory":                          stringKey,
+	"create_dirs":                        boolKey,
+	"umask":                              stringKey,
+	"serverurl":                          stringKey,
+	"depends_on":                         stringKey,
+	"restartpause":                       uintKey,
+	"schedule":                           cronKey,
+	"condition":                          conditionKey,
+	"restart_when_binary_changed":        boolKey,
+	"restart_cmd_when_binary_changed":    stringKey,
+	"restart_signal_when_binary_changed": stringKey,
+	"restart_directory_monitor":          stringKey,
+	"restart_file_pattern":               stringKey,
+	"restart_check_delay":                uintKey,
+}
+
+// the keys of the event listeners besides the program keys
+var eventListenerKeys = map[string]keyType{
+	"buffer_size":    uintKey,
+	"events":         stringKey,
+	"result_handler": stringKey,
+}
+
+// the known keys of the sections, the sections not listed are not checked
+var sectionKeys = map[string]map[string]keyType{
+	"zssld": {
+		"logfile":          stringKey,
+		"logfile_maxbytes": bytesKey,
+		"logfile_backups":  uintKey,
+		"logfile_rotate":   rotateKey,
+		"loglevel":         stringKey,
+		"pidfile":          stringKey,
+		"umask":            stringKey,
+		"nodaemon":         boolKey,
+		"silent":           boolKey,
+		"minfds":           uintKey,
+		"minprocs":         uintKey,
+		"nocleanup":        boolKey,
+		"childlogdir":      stringKey,
+		"user":             stringKey,
+		"directory":        stringKey,
+		"strip_ansi":       boolKey,
+		"environment":      stringKey,
+		"identifier":       stringKey,
+	},
+	"zsslctl": {
+		"serverurl":    stringKey,
+		"username":     stringKey,
+		"password":     stringKey,
+		"prompt":       stringKey,
+		"history_file": stringKey,
+	},
+	"unix_http_server": {
+		"file":     stringKey,
+		"chmod":    stringKey,
+		"chown":    stringKey,
+		"username": stringKey,
+		"password": stringKey,
+	},
+	"inet_http_server": {
+		"port":     stringKey,
+		"username": stringKey,
+		"password": stringKey,
+	},
+	"include": {
+		"files": stringKey,
+	},
+	"program-default": programKeys,
+	"program":         programKeys,
+	"eventlistener":   mergeKeys(programKeys, eventListenerKeys),
+}
+
+// the deprecated keys of the programs and the keys replacing them
+var deprecatedProgramKeys = map[string]string{
+	"logfile":          "stdout_logfile",
+	"logfile_maxbytes": "stdout_logfile_maxbytes",
+	"logfile_backups":  "stdout_logfile_backups",
+}
+
+// the deprecated keys of the sections and the keys replacing them. The
+// deprecated keys are still accepted, their values are taken as the values of
+// the replacing keys if the replacing keys are not set
+var deprecatedKeys = map[string]map[string]string{
+	"program-default": deprecatedProgramKeys,
+	"program":         deprecatedProgramKeys,
+	"eventlistener":   deprecatedProgramKeys,
+}
+
+func mergeKeys(keys ...map[string]keyType) map[string]keyType {
+	result := make(map[string]keyType)
+	for _, m := range keys {
+		for k, v := range m {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// get the section type, e.g. "program" for "program:web"
+func sectionType(name string) string {
+	if pos := strings.Index(name, ":"); pos != -1 {
+		return name[:pos]
+	}
+	return name
+}
+
+// record a problem found while parsing, the same problem is only recorded once
+func (c *Config) addProblem(section string, key string, msg string) {
+	problem := ValidationError{Section: section, Key: key, Msg: msg}
+	location, ok := c.locations[section][key]
+	if !ok {
+		location = c.locations[section][""]
+	}
+	problem.File, problem.Line = location.file, location.line
+	for _, p := range c.problems {
+		if p == problem {
+			return
+		}
+	}
+	c.problems = append(c.problems, problem)
+}
+
+// Validate checks the loaded configuration and returns all the problems found:
+// unknown keys, malformed int, bool and bytes values, programs without command
+// and process_name templates which can't be evaluated
+func (c *Config) Validate() []ValidationError {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.validate()
+}
+
+// validate the loaded configuration, the lock must be held. The processes of
+// a program with numprocs share its section, so each section is validated once
+func (c *Config) validate() []ValidationError {
+	result := append(make([]ValidationError, 0), c.problems...)
+	validated := make(map[string]bool)
+	for _, entry := range c.entriesOrdered(func(entry *Entry) bool {
+		return true
+	}, ByName) {
+		if validated[entry.sectionName()] {
+			continue
+		}
+		validated[entry.sectionName()] = true
+		for _, problem := range entry.validate() {
+			problem.File, problem.Line = entry.Source(problem.Key)
+			if problem.File == "" {
+				problem.File, problem.Line = entry.Source("")
+			}
+			result = append(result, problem)
+		}
+	}
+	return result
+}
+
+// the name of the section the entry is parsed from, the processes of a
+// program are named after the process but share the program section
+func (c *Entry) sectionName() string {
+	if c.section != "" {
+		return c.section
+	}
+	return c.Name
+}
+
+// check the keys of the entry against the known keys of its section type
+func (c *Entry) validate() []ValidationError {
+	result := make([]ValidationError, 0)
+	section := c.sectionName()
+	typ := sectionType(c.Name)
+	knownKeys, ok := sectionKeys[typ]
+	if !ok {
+		return result
+	}
+	keyValues := c.copyKeyValues()
+	if typ == "program" || typ == "eventlistener" {
+		if command, ok := keyValues["command"]; !ok || command == "" {
+			result = append(result, ValidationError{Section: section, Key: "command", Msg: "missing command"})
+		}
+	}
+	keys := make([]string, 0, len(keyValues))
+	for key := range keyValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := keyValues[key]
+		kt, ok := knownKeys[key]
+		if replacement, deprecated := deprecatedKeys[typ][key]; !ok && deprecated {
+			kt, ok = knownKeys[replacement]
+		}
+		if !ok {
+			msg := "unknown key"
+			if suggestion := suggestKey(key, knownKeys); suggestion != "" {
+				msg = fmt.Sprintf("unknown key, did you mean %q", suggestion)
+			}
+			result = append(result, ValidationError{Section: section, Key: key, Msg: msg})
+			continue
+		}
+		if msg := checkValue(kt, value); msg != "" {
+			result = append(result, ValidationError{Section: section, Key: key, Msg: msg})
+		}
+	}
+	for _, prefix := range []string{"", "stdout_", "stderr_"} {
+		backupsKey, maxBytesKey := prefix+"logfile_backups", prefix+"logfile_maxbytes"
+		if knownKeys[backupsKey] == uintKey && checkLogfileBackups(keyValues[backupsKey], keyValues[maxBytesKey]) {
+			result = append(result, ValidationError{Section: section, Key: backupsKey,
+				Msg: fmt.Sprintf("no backups with %s set, the log file is truncated once it is full", maxBytesKey)})
+		}
+	}
+	return result
+}
+
+// check if the log file is rotated by size without keeping any backup, i.e.
+// backups is 0 and maxBytes is greater than 0
+func checkLogfileBackups(backups string, maxBytes string) bool {
+	n, err := strconv.Atoi(backups)
+	if err != nil || n != 0 {
+		return false
+	}
+	size, err := parseBytes(maxBytes)
+	return err == nil && size > 0
+}
+
+// log the deprecated and unknown keys of the entry, the unknown keys are
+// logged with the known key closest to them
+func (c *Entry) warnKeys(logger *loadLogger) {
+	typ := sectionType(c.Name)
+	knownKeys, ok := sectionKeys[typ]
+	if !ok {
+		return
+	}
+	keyValues := c.copyKeyValues()
+	keys := make([]string, 0, len(keyValues))
+	for key := range keyValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := knownKeys[key]; ok {
+			continue
+		}
+		file, line := c.Source(key)
+		fields := Fields{"section": c.sectionName(), "key": key, "file": file, "line": line}
+		if replacement, ok := deprecatedKeys[typ][key]; ok {
+			fields["replacement"] = replacement
+			logger.log(WarnLevel, "deprecated configuration key", fields)
+			continue
+		}
+		if suggestion := suggestKey(key, knownKeys); suggestion != "" {
+			fields["suggestion"] = suggestion
+		}
+		logger.log(WarnLevel, "unknown configuration key", fields)
+	}
+}
+
+// get the known key closest to the unknown key, e.g. "autorestart" for
+// "autorstart", or empty string if no known key is close enough
+func suggestKey(key string, knownKeys map[string]keyType) string {
+	result, best := "", len(key)/3+1
+	for known := range knownKeys {
+		if d := editDistance(key, known); d < best || (d == best && result != "" && known < result) {
+			result, best = known, d
+		}
+	}
+	return result
+}
+
+// the Levenshtein distance between a and b
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// check the value against the key type, return the description of the problem or empty string
+func checkValue(kt keyType, value string) string {
+	switch kt {
+	case intKey:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Sprintf("invalid int value %q", value)
+		}
+	case uintKey:
+		if i, err := strconv.Atoi(value); err != nil {
+			return fmt.Sprintf("invalid int value %q", value)
+		} else if i < 0 {
+			return fmt.Sprintf("negative value %d", i)
+		}
+	case boolKey:
+		if _, err := parseBool(value); err != nil {
+			return err.Error()
+		}
+	case bytesKey:
+		if _, err := parseBytes(value); err != nil {
+			return err.Error()
+		}
+	case durationKey:
+		if _, err := parseDuration(value); err != nil {
+			return err.Error()
+		}
+	case cronKey:
+		if _, err := parseCron(value); err != nil {
+			return err.Error()
+		}
+	case conditionKey:
+		if _, err := parseConditions(value); err != nil {
+			return err.Error()
+		}
+	case rotateKey:
+		if _, err := parseRotate(value); err != nil {
+			return err.Error()
+		}
+	case autoRestartKey:
+		if _, err := parseBool(value); err != nil && value != "unexpected" {
+			return fmt.Sprintf("invalid autorestart value %q", value)
+		}
+	}
+	return ""
+}
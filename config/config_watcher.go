@@ -0,0 +1,254 @@
+package config
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// WatchEvent the result of reloading the configuration after its files are changed
+type WatchEvent struct {
+	// the names of the added, changed and removed programs, see Config.Reload
+	Added   []string
+	Changed []string
+	Removed []string
+	// the programs whose "envFiles" are changed, their environment is stale
+	// and they need restarting to pick it up, see WatchOptions.EnvFiles
+	EnvChanged []string
+	// the reloading error, the configuration is kept unchanged if not nil
+	Err error
+}
+
+// WatchOptions the options of the Watcher
+type WatchOptions struct {
+	// the changes made within Debounce duration of each other are handled at once
+	Debounce time.Duration
+	// watch the "envFiles" of the programs also, the programs whose env files
+	// are changed are reported in WatchEvent.EnvChanged without reloading the
+	// configuration, e.g. to restart the programs after a secret rotation
+	EnvFiles bool
+}
+
+// Watcher reloads the configuration when the configuration file, the include
+// files or the include directories are changed. The remote files are not watched.
+//
+// The configuration is reloaded in the goroutine of the watcher, the other
+// goroutines may keep reading it, see Config.Generation
+type Watcher struct {
+	config   *Config
+	debounce time.Duration
+	watcher  *fsnotify.Watcher
+	events   chan WatchEvent
+	// the watched directories
+	dirs map[string]bool
+	// watch the env files, and the programs using each env file by its absolute path
+	watchEnv bool
+	envFiles map[string][]string
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWatcher creates a Watcher of the loaded configuration. The changes made
+// within debounce duration of each other are reloaded at once
+func NewWatcher(config *Config, debounce time.Duration) (*Watcher, error) {
+	return NewWatcherWithOptions(config, WatchOptions{Debounce: debounce})
+}
+
+// NewWatcherWithOptions creates a Watcher of the loaded configuration with the options
+func NewWatcherWithOptions(config *Config, options WatchOptions) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{config: config,
+		debounce: options.Debounce,
+		watcher:  fw,
+		events:   make(chan WatchEvent),
+		dirs:     make(map[string]bool),
+		watchEnv: options.EnvFiles,
+		envFiles: make(map[string][]string),
+		done:     make(chan struct{})}
+	w.updateWatches()
+	go w.run()
+	return w, nil
+}
+
+// Events returns the channel of the reload events, it is closed after the watcher is closed
+func (w *Watcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Close stops watching the configuration files
+func (w *Watcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err = w.watcher.Close()
+	})
+	return err
+}
+
+func (w *Watcher) run() {
+	defer close(w.events)
+	var timer *time.Timer
+	var fire <-chan time.Time
+	// the configuration files are changed, and the programs whose env files are changed
+	reload := false
+	envChanged := make(map[string]bool)
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if w.isConfigFile(event.Name) {
+				reload = true
+			} else if programs, ok := w.envFiles[filepath.Clean(event.Name)]; ok {
+				for _, name := range programs {
+					envChanged[name] = true
+				}
+			} else {
+				continue
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(w.debounce)
+			fire = timer.C
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.config.warn("fail to watch the configuration files", Fields{log.ErrorKey: err})
+		case <-fire:
+			fire = nil
+			var event WatchEvent
+			if reload {
+				event.Added, event.Changed, event.Removed, event.Err = w.config.Reload()
+				w.updateWatches()
+			}
+			// the added and changed programs are restarted anyway
+			restarted := make(map[string]bool)
+			for _, name := range append(event.Added, event.Changed...) {
+				restarted[name] = true
+			}
+			for name := range envChanged {
+				if w.config.GetProgram(name) != nil && !restarted[name] {
+					event.EnvChanged = append(event.EnvChanged, name)
+				}
+			}
+			sort.Strings(event.EnvChanged)
+			reloaded := reload
+			reload = false
+			envChanged = make(map[string]bool)
+			if !reloaded && len(event.EnvChanged) == 0 {
+				continue
+			}
+			select {
+			case w.events <- event:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// check if the changed file is a loaded configuration file or is in an include directory
+func (w *Watcher) isConfigFile(name string) bool {
+	w.config.lock.RLock()
+	defer w.config.lock.RUnlock()
+	name = filepath.Clean(name)
+	if isBundleFile(w.config.configFile) && absConfigPath(w.config.configFile) == name {
+		return true
+	}
+	for file := range w.config.sources {
+		if filepath.Clean(file) == name {
+			return true
+		}
+	}
+	for _, file := range w.config.manifests {
+		if filepath.Clean(file) == name {
+			return true
+		}
+	}
+	dir := filepath.Dir(name)
+	for _, includeDir := range w.config.includeDirs {
+		if filepath.Clean(includeDir) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// watch the directories of the loaded configuration files and the include
+// directories, the files are replaced rather than written by many editors
+func (w *Watcher) updateWatches() {
+	dirs := w.watchedDirs()
+	for dir := range w.dirs {
+		if !dirs[dir] {
+			w.watcher.Remove(dir)
+		}
+	}
+	for dir := range dirs {
+		if w.dirs[dir] {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			w.config.warn("fail to watch the configuration directory", Fields{log.ErrorKey: err, "dir": dir})
+			delete(dirs, dir)
+		}
+	}
+	w.dirs = dirs
+}
+
+// get the directories to watch and update the watched env files
+func (w *Watcher) watchedDirs() map[string]bool {
+	w.config.lock.RLock()
+	defer w.config.lock.RUnlock()
+	dirs := make(map[string]bool)
+	files, _ := w.config.getConfigFilePaths(w.config.bundle.main)
+	if isBundleFile(w.config.configFile) {
+		// the bundle is watched, the files extracted from it are replaced by loading
+		files = append(files, absConfigPath(w.config.configFile))
+	}
+	for _, file := range files {
+		if !isRemoteFile(file) && file != "" {
+			dirs[filepath.Dir(file)] = true
+		}
+	}
+	for file := range w.config.sources {
+		if isRemoteFile(file) {
+			continue
+		}
+		dirs[filepath.Dir(filepath.Clean(file))] = true
+	}
+	for _, dir := range w.config.includeDirs {
+		dirs[filepath.Clean(dir)] = true
+	}
+	for _, file := range w.config.manifests {
+		dirs[filepath.Dir(filepath.Clean(file))] = true
+	}
+	w.envFiles = make(map[string][]string)
+	if w.watchEnv {
+		for name, entry := range w.config.programs {
+			envFiles, _ := entry.rawLookup("envFiles")
+			for _, file := range envFilePaths(entry.expandHere(envFiles)) {
+				if path, err := filepath.Abs(file); err == nil {
+					w.envFiles[path] = append(w.envFiles[path], name)
+					dirs[filepath.Dir(path)] = true
+				}
+			}
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/lettered/zssld-tools/faults"
+)
+
+// iniLine a logical line of the ini file, a key line includes its
+// continuation lines
+type iniLine struct {
+	// the line number of the first physical line, starting from 1
+	num int
+	// the physical lines without the line breaks
+	lines []string
+	// the section of the line, or the name of the section line
+	section   string
+	isSection bool
+	// the key of the key line, empty for the other lines
+	key string
+}
+
+// split the ini content to the logical lines the same way as the ini loader
+func scanIniLines(b []byte) []iniLine {
+	text := strings.TrimSuffix(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n")
+	if text == "" {
+		return make([]iniLine, 0)
+	}
+	physical := strings.Split(text, "\n")
+	result := make([]iniLine, 0, len(physical))
+	section := ""
+	keyIndent := -1
+	for i := 0; i < len(physical); i++ {
+		line := physical[i]
+		if n := len(result); n > 0 && result[n-1].key != "" && keyIndent >= 0 && indentOf(line) > keyIndent {
+			// the indented value line of the previous key
+			result[n-1].lines = append(result[n-1].lines, line)
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		item := iniLine{num: i + 1, lines: []string{line}, section: section}
+		switch {
+		case trimmed == "" || trimmed[0] == ';' || trimmed[0] == '#':
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			item.section = section
+			item.isSection = true
+			keyIndent = -1
+		case strings.ContainsAny(line, "=:"):
+			pos := strings.IndexAny(line, "=:")
+			item.key = strings.TrimSpace(line[:pos])
+			keyIndent = indentOf(line)
+			value := strings.TrimRightFunc(strings.TrimLeftFunc(line[pos+1:], unicode.IsSpace), unicode.IsSpace)
+			multiline := strings.HasPrefix(value, `"""`)
+			if multiline && !(len(value) >= 6 && strings.HasSuffix(value, `"""`)) {
+				// the multiline value ends with """
+				for i+1 < len(physical) {
+					i++
+					item.lines = append(item.lines, physical[i])
+					if strings.HasSuffix(strings.TrimRightFunc(physical[i], unicode.IsSpace), `"""`) {
+						break
+					}
+				}
+			}
+			for !multiline && hasContinuation(value) && i+1 < len(physical) {
+				i++
+				item.lines = append(item.lines, physical[i])
+				value = strings.TrimRightFunc(physical[i], unicode.IsSpace)
+			}
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// the number of the leading spaces
+func indentOf(s string) int {
+	return len(s) - len(strings.TrimLeftFunc(s, unicode.IsSpace))
+}
+
+// check if the value ends with an odd number of '\', which continues the value on the next line
+func hasContinuation(value string) bool {
+	n := 0
+	for i := len(value) - 1; i >= 0 && value[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// escape the value so the ini loader reads it back unchanged
+func escapeIniValue(value string) string {
+	var buf strings.Builder
+	for _, r := range value {
+		switch r {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case ';':
+			buf.WriteString(`\;`)
+		case '#':
+			buf.WriteString(`\#`)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// GetFiles returns the loaded configuration files in the merging order, the
+// main configuration file is the first one
+func (c *Config) GetFiles() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append(make([]string, 0, len(c.files)), c.files...)
+}
+
+// WriteTo writes the main configuration file with the values set by
+// Entry.SetString, see WriteFileTo
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	c.lock.RLock()
+	file := c.getConfigFilePath()
+	c.lock.RUnlock()
+	return c.WriteFileTo(file, w)
+}
+
+// WriteFileTo writes the loaded ini configuration file with the values set by
+// Entry.SetString. The sections order, the comments and the [include] section
+// of the file are kept, the keys set but not in the file are added after the
+// last key of their section. The entries of the included files are written by
+// their own files, see GetFiles
+func (c *Config) WriteFileTo(file string, w io.Writer) (int64, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	source, ok := c.sources[file]
+	if !ok {
+		return 0, faults.NewFault(faults.NoFile, fmt.Sprintf("%s is not loaded", file))
+	}
+	if isYamlFile(file) || isJSONFile(file) {
+		return 0, faults.NewFault(faults.BadArguments, fmt.Sprintf("%s is not an ini file", file))
+	}
+
+	// the entries of each section, the process entries share their program section
+	sectionEntries := make(map[string][]*Entry)
+	for _, entry := range c.entriesOrdered(func(entry *Entry) bool { return true }, ByName) {
+		sectionEntries[entry.section] = append(sectionEntries[entry.section], entry)
+	}
+	if c.compat {
+		// the zssld sections are loaded from the legacy supervisord sections
+		// if they are not in the file
+		for alias, name := range supervisordAliases {
+			if source.index == nil || source.index.lines[name] == nil {
+				sectionEntries[alias] = sectionEntries[name]
+			}
+		}
+	}
+	// the modified value of the key in the section
+	modifiedValue := func(section string, key string) (string, bool) {
+		for _, entry := range sectionEntries[section] {
+			if entry.isModified(key) {
+				return entry.rawLookup(key)
+			}
+		}
+		return "", false
+	}
+
+	lines := scanIniLines(source.content)
+	// the index of the last key line of each section
+	lastKeys := make(map[string]int)
+	fileKeys := make(map[string]map[string]bool)
+	for i, line := range lines {
+		if line.isSection {
+			lastKeys[line.section] = i
+			fileKeys[line.section] = make(map[string]bool)
+		} else if line.key != "" && line.section != "" {
+			lastKeys[line.section] = i
+			fileKeys[line.section][line.key] = true
+		}
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(source.content)))
+	for i, line := range lines {
+		if value, ok := modifiedValue(line.section, line.key); ok && line.key != "" {
+			fmt.Fprintf(buf, "%s%s=%s\n", line.lines[0][:indentOf(line.lines[0])], line.key, escapeIniValue(value))
+		} else {
+			for _, l := range line.lines {
+				fmt.Fprintf(buf, "%s\n", l)
+			}
+		}
+		if line.section == "" || lastKeys[line.section] != i {
+			continue
+		}
+		// the keys set but not in the file
+		added := make([]string, 0)
+		for _, entry := range sectionEntries[line.section] {
+			for key := range entry.modified {
+				if !fileKeys[line.section][key] {
+					fileKeys[line.section][key] = true
+					added = append(added, key)
+				}
+			}
+		}
+		sort.Strings(added)
+		for _, key := range added {
+			value, _ := modifiedValue(line.section, key)
+			fmt.Fprintf(buf, "%s=%s\n", key, escapeIniValue(value))
+		}
+	}
+	return buf.WriteTo(w)
+}
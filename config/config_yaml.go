@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lettered/zssld-tools/faults"
+	"github.com/ochinchina/go-ini"
+	"gopkg.in/yaml.v3"
+)
+
+// the top level keys of the yaml configuration which hold named sections, and
+// the prefix of the section names they are mapped to. An example:
+//
+//	zssld:
+//	  logfile: /var/log/zssld.log
+//	programs:
+//	  web:
+//	    command: /usr/bin/web --port %(process_num)d
+//	    numprocs: 2
+//	    environment:
+//	      MODE: prod
+//	groups:
+//	  services:
+//	    programs: [web]
+//	include:
+//	  files: [conf.d/*.yaml]
+var yamlSectionPrefixes = map[string]string{
+	"programs":       "program:",
+	"groups":         "group:",
+	"eventlisteners": "eventlistener:",
+	"templates":      "template:",
+}
+
+// check if the configuration file is in yaml format by its extension
+func isYamlFile(fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// parse the yaml configuration to the ini sections, the declaration order of
+// the sections and the lines of the keys are returned in the index
+func parseYaml(b []byte) (*ini.Ini, *sourceIndex, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, nil, faults.NewFault(faults.BadArguments, err.Error())
+	}
+	result := ini.NewIni()
+	index := newSourceIndex()
+	if len(doc.Content) == 0 {
+		return result, index, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, yamlError(root, "the configuration must be a mapping")
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		name, value := root.Content[i].Value, root.Content[i+1]
+		prefix, ok := yamlSectionPrefixes[name]
+		if !ok {
+			if err := addYamlSection(result, index, name, root.Content[i].Line, value); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			return nil, nil, yamlError(value, fmt.Sprintf("%s must be a mapping", name))
+		}
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			if err := addYamlSection(result, index, prefix+value.Content[j].Value, value.Content[j].Line, value.Content[j+1]); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return result, index, nil
+}
+
+// add the yaml mapping declared at line as a section to cfg
+func addYamlSection(cfg *ini.Ini, index *sourceIndex, name string, line int, node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return yamlError(node, fmt.Sprintf("section %s must be a mapping", name))
+	}
+	section := cfg.NewSection(name)
+	index.add(name, "", line)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		value, err := yamlValue(name, key, node.Content[i+1])
+		if err != nil {
+			return err
+		}
+		section.Add(key, value)
+		index.add(name, key, node.Content[i].Line)
+	}
+	return nil
+}
+
+// convert the yaml value of the key in section to the ini value. The sequence
+// is joined with "," (with " " for the include files) and the mapping is
+// converted to the environment format: KEY1="value1",KEY2="value2"
+func yamlValue(section string, key string, node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.AliasNode:
+		return yamlValue(section, key, node.Alias)
+	case yaml.SequenceNode:
+		sep := ","
+		if section == "include" && key == "files" {
+			sep = " "
+		}
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", yamlError(item, fmt.Sprintf("items of %s in section %s must be scalars", key, section))
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, sep), nil
+	case yaml.MappingNode:
+		pairs := make([]string, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i+1].Kind != yaml.ScalarNode {
+				return "", yamlError(node.Content[i+1], fmt.Sprintf("values of %s in section %s must be scalars", key, section))
+			}
+			pairs = append(pairs, node.Content[i].Value+"="+quoteEnvValue(node.Content[i+1].Value))
+		}
+		return strings.Join(pairs, ","), nil
+	}
+	return "", yamlError(node, fmt.Sprintf("unsupported value of %s in section %s", key, section))
+}
+
+func yamlError(node *yaml.Node, msg string) error {
+	return faults.NewFault(faults.BadArguments, fmt.Sprintf("line %d: %s", node.Line, msg))
+}
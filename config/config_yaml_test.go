@@ -0,0 +1,49 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYamlEnvironmentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want map[string]string
+	}{
+		{"plain", "A: 1\nB: two words", map[string]string{"A": "1", "B": "two words"}},
+		{"quotes", `A: 'say "hi"'`, map[string]string{"A": `say "hi"`}},
+		{"trailing backslash", `B: 'C:\dir\'`, map[string]string{"B": `C:\dir\`}},
+		{"escaped quote", `C: '\"'`, map[string]string{"C": `\"`}},
+		{"separators", "D: 'a, b = c'", map[string]string{"D": "a, b = c"}},
+		{"empty", "E: ''", map[string]string{"E": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := "programs:\n  web:\n    command: /bin/web\n    environment:\n"
+			for _, line := range strings.Split(tt.yaml, "\n") {
+				doc += "      " + line + "\n"
+			}
+			cfg, _, err := parseYaml([]byte(doc))
+			if err != nil {
+				t.Fatalf("parseYaml: %v", err)
+			}
+			section, err := cfg.GetSection("program:web")
+			if err != nil {
+				t.Fatalf("no program:web section: %v", err)
+			}
+			value, err := section.GetValue("environment")
+			if err != nil {
+				t.Fatalf("no environment: %v", err)
+			}
+			got, err := ParseEnvironment(value)
+			if err != nil {
+				t.Fatalf("ParseEnvironment(%q): %v", value, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEnvironment(%q) = %v, want %v", value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lettered/zssld-tools/faults"
+)
+
+// ParseError the error reported when a configuration value can't be parsed
+type ParseError struct {
+	// Input the value being parsed
+	Input string
+	// Pos the byte offset in Input where the error is found
+	Pos int
+	// Msg describes the error
+	Msg string
+}
+
+// Error returns the error message with the position of the error
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at position %d in %q", e.Msg, e.Pos, e.Input)
+}
+
+// FaultCode returns the fault code of the parse error
+func (e *ParseError) FaultCode() faults.FaultCode {
+	return faults.BadArguments
+}
+
+func newParseError(input string, pos int, msg string) *ParseError {
+	return &ParseError{Input: input, Pos: pos, Msg: msg}
+}
+
+// skip the spaces in s from pos and return the position of first non-space char
+func skipSpaces(s string, pos int) int {
+	for pos < len(s) && unicode.IsSpace(rune(s[pos])) {
+		pos++
+	}
+	return pos
+}
+
+// ParseEnvironment parses the environment string of a section to the key/value map.
+// The pairs are separated by "," and the value can be quoted to contain "," or
+// to keep its leading and trailing spaces:
+//
+//	environment = A="env 1",B='this, is a test',C=3,D=
+//
+// In the double quoted values "\"" and "\\" are the escaped quote and
+// backslash, the single quoted values are taken literally. The values may span
+// multiple lines, and the pairs may be put on separate lines:
+//
+//	environment =
+//	    A="line 1
+//	line 2",
+//	    B=2
+//
+// The malformed pairs are reported in the returned error and skipped, the
+// valid pairs are still returned in the map
+func ParseEnvironment(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	errs := make([]error, 0)
+	n := len(s)
+	pos := 0
+	for pos = skipSpaces(s, pos); pos < n; pos = skipSpaces(s, pos) {
+		// empty pair, e.g. a trailing ","
+		if s[pos] == ',' {
+			pos++
+			continue
+		}
+		// find the '='
+		eq := strings.IndexAny(s[pos:], "=,")
+		if eq == -1 {
+			errs = append(errs, newParseError(s, pos, "missing '=' after key"))
+			break
+		}
+		if s[pos+eq] == ',' {
+			errs = append(errs, newParseError(s, pos, "missing '=' after key"))
+			pos += eq + 1
+			continue
+		}
+		key := strings.TrimSpace(s[pos : pos+eq])
+		if key == "" {
+			errs = append(errs, newParseError(s, pos, "empty key"))
+		}
+		pos = skipSpaces(s, pos+eq+1)
+
+		if pos < n && (s[pos] == '"' || s[pos] == '\'') {
+			value, end, err := readQuoted(s, pos)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			pos = skipSpaces(s, end)
+			if pos < n && s[pos] != ',' {
+				errs = append(errs, newParseError(s, pos, "expect ',' after quoted value"))
+				// skip the rest of the pair
+				if end := strings.IndexByte(s[pos:], ','); end != -1 {
+					pos += end + 1
+				} else {
+					pos = n
+				}
+				continue
+			}
+			if key != "" {
+				result[key] = value
+			}
+			pos++
+		} else {
+			end := strings.IndexByte(s[pos:], ',')
+			if end == -1 {
+				end = n - pos
+			}
+			if key != "" {
+				result[key] = strings.TrimSpace(s[pos : pos+end])
+			}
+			pos += end + 1
+		}
+	}
+	if len(errs) == 1 {
+		return result, errs[0]
+	}
+	return result, errors.Join(errs...)
+}
+
+// escapes the backslashes and the double quotes of the double quoted values
+var envValueQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quote the environment value with double quotes, escaping "\" and "\"" so
+// ParseEnvironment reads it back as it is
+func quoteEnvValue(value string) string {
+	return `"` + envValueQuoter.Replace(value) + `"`
+}
+
+// read the value quoted by s[pos] and return it with the position after the
+// closing quote
+func readQuoted(s string, pos int) (string, int, error) {
+	quote := s[pos]
+	var buf strings.Builder
+	for i := pos + 1; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == quote:
+			return buf.String(), i + 1, nil
+		case ch == '\\' && quote == '"' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\'):
+			i++
+			buf.WriteByte(s[i])
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	return "", 0, newParseError(s, pos, "unterminated quoted value")
+}
+
+// the separators of the list values like "programs" and "files", the
+// elements are separated by commas or spaces as supervisor does
+const listSeparators = ", \t\r\n"
+
+// split s by the separator for which sepLen returns its length at s[i], or 0
+// if there is no separator at s[i]. The elements are trimmed and the empty
+// elements are removed. The parts of an element quoted by " or ' are taken as
+// they are, e.g. a "b, c" is split to [a "b, c"] with the quotes removed, and
+// the quote without the closing quote is taken literally
+func splitQuoted(s string, sepLen func(s string, i int) int) []string {
+	result := make([]string, 0)
+	var buf strings.Builder
+	// the element has quoted parts, and the length of the element without
+	// its unquoted trailing spaces
+	quoted, end := false, 0
+	flush := func() {
+		if element := buf.String()[:end]; element != "" || quoted {
+			result = append(result, element)
+		}
+		buf.Reset()
+		quoted, end = false, 0
+	}
+	for i := 0; i < len(s); i++ {
+		if n := sepLen(s, i); n > 0 {
+			flush()
+			i += n - 1
+			continue
+		}
+		ch := s[i]
+		if ch == '"' || ch == '\'' {
+			if value, next, err := readQuoted(s, i); err == nil {
+				buf.WriteString(value)
+				quoted, end = true, buf.Len()
+				i = next - 1
+				continue
+			}
+		}
+		if unicode.IsSpace(rune(ch)) {
+			if buf.Len() > 0 {
+				buf.WriteByte(ch)
+			}
+			continue
+		}
+		buf.WriteByte(ch)
+		end = buf.Len()
+	}
+	flush()
+	return result
+}
+
+// split s by sep, see splitQuoted
+func splitBySep(s string, sep string) []string {
+	return splitQuoted(s, func(s string, i int) int {
+		if sep != "" && strings.HasPrefix(s[i:], sep) {
+			return len(sep)
+		}
+		return 0
+	})
+}
+
+// split s by any char of seps, see splitQuoted
+func splitByAny(s string, seps string) []string {
+	return splitQuoted(s, func(s string, i int) int {
+		if strings.IndexByte(seps, s[i]) != -1 {
+			return 1
+		}
+		return 0
+	})
+}
+
+// GlobToRegexp converts the file pattern to the go regexp matching the whole
+// file name the same way as filepath.Match, e.g. "*.ini" matches "a.ini" but
+// not "a.ini.bak" or "dir/a.ini".
+//
+// "*" matches any sequence of non-separator chars, "?" matches any single
+// non-separator char, "[0-9]" matches a char in the class and "[^0-9]" a char
+// not in the class, and "\" escapes the next char except on Windows where it
+// is the path separator. All other chars match themselves
+func GlobToRegexp(pattern string) (string, error) {
+	notSeparator := "[^" + regexp.QuoteMeta(string(filepath.Separator)) + "]"
+	var buf strings.Builder
+	buf.WriteString("^")
+	for i := 0; i < len(pattern); {
+		switch ch := pattern[i]; {
+		case ch == '*':
+			buf.WriteString(notSeparator + "*")
+			i++
+		case ch == '?':
+			buf.WriteString(notSeparator)
+			i++
+		case ch == '[':
+			class, next, err := globClassToRegexp(pattern, i)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(class)
+			i = next
+		default:
+			r, next, err := globChar(pattern, i)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+			i = next
+		}
+	}
+	buf.WriteString("$")
+	return buf.String(), nil
+}
+
+// read the possibly escaped char of the pattern at pattern[pos], and return
+// it with the position after it
+func globChar(pattern string, pos int) (rune, int, error) {
+	i := pos
+	if pattern[i] == '\\' && filepath.Separator != '\\' {
+		i++
+		if i >= len(pattern) {
+			return 0, 0, newParseError(pattern, pos, "trailing escape char")
+		}
+	}
+	r, n := utf8.DecodeRuneInString(pattern[i:])
+	if r == utf8.RuneError && n == 1 {
+		return 0, 0, newParseError(pattern, i, "invalid UTF-8 char")
+	}
+	return r, i + n, nil
+}
+
+// convert the character class of the pattern starting at pattern[pos] to the
+// go regexp class, and return the position after the class
+func globClassToRegexp(pattern string, pos int) (string, int, error) {
+	i := pos + 1
+	negated := i < len(pattern) && pattern[i] == '^'
+	if negated {
+		i++
+	}
+	var ranges strings.Builder
+	for nrange := 0; ; nrange++ {
+		if i >= len(pattern) {
+			return "", 0, newParseError(pattern, pos, "unterminated character class")
+		}
+		if pattern[i] == ']' && nrange > 0 {
+			i++
+			break
+		}
+		if pattern[i] == '-' || pattern[i] == ']' {
+			return "", 0, newParseError(pattern, i, fmt.Sprintf("unexpected '%c' in character class", pattern[i]))
+		}
+		lo, next, err := globChar(pattern, i)
+		if err != nil {
+			return "", 0, err
+		}
+		hi := lo
+		if i = next; i < len(pattern) && pattern[i] == '-' {
+			if i++; i >= len(pattern) || pattern[i] == '-' || pattern[i] == ']' {
+				return "", 0, newParseError(pattern, i, "missing end of character range")
+			}
+			if hi, i, err = globChar(pattern, i); err != nil {
+				return "", 0, err
+			}
+		}
+		// the reversed range matches nothing
+		if lo <= hi {
+			fmt.Fprintf(&ranges, `\x{%x}-\x{%x}`, lo, hi)
+		}
+	}
+	switch {
+	case ranges.Len() > 0 && negated:
+		return "[^" + ranges.String() + "]", i, nil
+	case ranges.Len() > 0:
+		return "[" + ranges.String() + "]", i, nil
+	case negated:
+		return `[\x{0}-\x{10ffff}]`, i, nil
+	default:
+		return `[^\x{0}-\x{10ffff}]`, i, nil
+	}
+}
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"testing"
+)
+
+func TestParseEnvironment(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantPos int
+	}{
+		{"empty", "", map[string]string{}, -1},
+		{"plain", "A=1,B=two", map[string]string{"A": "1", "B": "two"}, -1},
+		{"spaces", " A = 1 , B= two words ", map[string]string{"A": "1", "B": "two words"}, -1},
+		{"empty value", "A=,B=", map[string]string{"A": "", "B": ""}, -1},
+		{"trailing comma", "A=1,,B=2,", map[string]string{"A": "1", "B": "2"}, -1},
+		{"double quoted", `A="env 1",B="a, b"`, map[string]string{"A": "env 1", "B": "a, b"}, -1},
+		{"kept spaces", `A="  x  "`, map[string]string{"A": "  x  "}, -1},
+		{"single quoted", `A='this, is a test',B='\"'`, map[string]string{"A": "this, is a test", "B": `\"`}, -1},
+		{"escapes", `A="say \"hi\"",B="C:\\dir\\",C="\n"`, map[string]string{"A": `say "hi"`, "B": `C:\dir\`, "C": `\n`}, -1},
+		{"equal sign in value", "A=b=c", map[string]string{"A": "b=c"}, -1},
+		{"multiline", "\n    A=\"line 1\nline 2\",\n    B=2", map[string]string{"A": "line 1\nline 2", "B": "2"}, -1},
+		{"missing equal sign", "A", map[string]string{}, 0},
+		{"empty key", "=1", map[string]string{}, 0},
+		{"unterminated quote", `A="x`, map[string]string{}, 2},
+		{"text after quote", `A="x"y`, map[string]string{}, 5},
+		{"valid pairs kept", "A=1,B", map[string]string{"A": "1"}, 4},
+		{"bad pair skipped", "A=1,B,C=3", map[string]string{"A": "1", "C": "3"}, 4},
+		{"bad quoted pair skipped", `A="x"y,B=2`, map[string]string{"B": "2"}, 5},
+		{"empty key skipped", `="a,b",B=2`, map[string]string{"B": "2"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEnvironment(tt.input)
+			if tt.wantPos >= 0 {
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("ParseEnvironment(%q) = %v, want ParseError", tt.input, err)
+				}
+				if parseErr.Pos != tt.wantPos {
+					t.Errorf("ParseEnvironment(%q) error at %d, want %d", tt.input, parseErr.Pos, tt.wantPos)
+				}
+			} else if err != nil {
+				t.Fatalf("ParseEnvironment(%q): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEnvironment(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzParseEnvironment(f *testing.F) {
+	for _, seed := range []string{"A=1,B=two", `A="say \"hi\"",B='a, b'`, "A=1,B", "\n A=\"x\ny\",\n B=", `C="C:\\dir\\"`} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		env, err := ParseEnvironment(s)
+		if env == nil {
+			t.Fatalf("ParseEnvironment(%q) returned nil map with error %v", s, err)
+		}
+		// the parsed pairs, formatted with quoted values, read back the same
+		formatted := formatEnvironment(env)
+		got, err := ParseEnvironment(formatted)
+		if err != nil {
+			t.Fatalf("ParseEnvironment(%q) of %q: %v", formatted, s, err)
+		}
+		if !reflect.DeepEqual(got, env) {
+			t.Errorf("ParseEnvironment(%q) = %q, want %q", formatted, got, env)
+		}
+	})
+}
+
+func TestParseExpression(t *testing.T) {
+	env := map[string]string{"program_name": "web", "process_num": "3", "here": "/etc/zssld"}
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantPos int
+	}{
+		{"literal", "/usr/bin/web", "/usr/bin/web", -1},
+		{"string", "%(program_name)s.log", "web.log", -1},
+		{"int", "%(program_name)s_%(process_num)d", "web_3", -1},
+		{"padded int", "%(process_num)02d", "03", -1},
+		{"width", "[%(program_name)5s]", "[  web]", -1},
+		{"left aligned", "[%(program_name)-5s]", "[web  ]", -1},
+		{"percent without name", "100%", "100%", -1},
+		{"missing paren", "%(program_name", "", 0},
+		{"empty name", "a%()s", "", 1},
+		{"missing type", "%(program_name)", "", 0},
+		{"unknown type", "%(program_name)x", "", 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseExpression(tt.input)
+			if tt.wantPos >= 0 {
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("ParseExpression(%q) = %v, want ParseError", tt.input, err)
+				}
+				if parseErr.Pos != tt.wantPos {
+					t.Errorf("ParseExpression(%q) error at %d, want %d", tt.input, parseErr.Pos, tt.wantPos)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseExpression(%q): %v", tt.input, err)
+			}
+			got, err := expr.Eval(env)
+			if err != nil {
+				t.Fatalf("Eval(%q): %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpressionEvalErrors(t *testing.T) {
+	env := map[string]string{"program_name": "web"}
+	for _, input := range []string{"%(unknown)s", "%(program_name)d"} {
+		expr, err := ParseExpression(input)
+		if err != nil {
+			t.Fatalf("ParseExpression(%q): %v", input, err)
+		}
+		if got, err := expr.Eval(env); err == nil {
+			t.Errorf("Eval(%q) = %q, want error", input, got)
+		}
+	}
+}
+
+func TestSplitQuoted(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		sep   string
+		any   bool
+		want  []string
+	}{
+		{"empty", "", ",", false, []string{}},
+		{"commas", "a,b , c", ",", false, []string{"a", "b", "c"}},
+		{"empty elements", ",a,,b,", ",", false, []string{"a", "b"}},
+		{"quoted separator", `db, "my, cache"`, ",", false, []string{"db", "my, cache"}},
+		{"single quoted", `'a b' c`, " ", false, []string{"a b", "c"}},
+		{"quoted empty", `a,"",b`, ",", false, []string{"a", "", "b"}},
+		{"quoted part", `x"a,b"y,z`, ",", false, []string{"xa,by", "z"}},
+		{"unterminated quote", `"a,b`, ",", false, []string{`"a`, "b"}},
+		{"inner spaces", "a b , c", ",", false, []string{"a b", "c"}},
+		{"multi-char separator", "a::b::c", "::", false, []string{"a", "b", "c"}},
+		{"any separator", "a, b\tc\nd", listSeparators, true, []string{"a", "b", "c", "d"}},
+		{"any separator quoted", `a "b c",d`, listSeparators, true, []string{"a", "b c", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			if tt.any {
+				got = splitByAny(tt.input, tt.sep)
+			} else {
+				got = splitBySep(tt.input, tt.sep)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("split(%q, %q) = %q, want %q", tt.input, tt.sep, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the patterns use the escape char and the unix separator")
+	}
+	names := []string{"", "a", "a.ini", "b.ini", "a.ini.bak", ".ini", "dir/a.ini", "ab", "a]", "a*", "a\\b", "x-y", "3.conf", "z.conf", "é.conf", "a\nb"}
+	tests := []struct {
+		pattern string
+		want    []string
+		wantPos int
+	}{
+		{"*.ini", []string{"a.ini", "b.ini", ".ini"}, -1},
+		{"a.*", []string{"a.ini", "a.ini.bak"}, -1},
+		{"?.ini", []string{"a.ini", "b.ini"}, -1},
+		{"*/*.ini", []string{"dir/a.ini"}, -1},
+		{"dir?a.ini", nil, -1},
+		{"[0-9].conf", []string{"3.conf"}, -1},
+		{"[^0-9].conf", []string{"z.conf", "é.conf"}, -1},
+		{"[a-ce-é].conf", []string{"z.conf", "é.conf"}, -1},
+		{"[z-a].conf", nil, -1},
+		{"[^z-a].conf", []string{"3.conf", "z.conf", "é.conf"}, -1},
+		{"a[]]", nil, 2},
+		{"a]", []string{"a]"}, -1},
+		{"a\\*", []string{"a*"}, -1},
+		{"a[\\*]", []string{"a*"}, -1},
+		{"a\\\\b", []string{"a\\b"}, -1},
+		{"x-y", []string{"x-y"}, -1},
+		{"a?b", []string{"a\\b", "a\nb"}, -1},
+		{"a*b", []string{"ab", "a\\b", "a\nb"}, -1},
+		{"a\\", nil, 1},
+		{"[a", nil, 0},
+		{"[^", nil, 0},
+		{"[-a]", nil, 1},
+		{"[a-]", nil, 3},
+		{"[a-", nil, 3},
+		{"*.[", nil, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			expr, err := GlobToRegexp(tt.pattern)
+			if _, matchErr := filepath.Match(tt.pattern, ""); (matchErr != nil) != (tt.wantPos >= 0) {
+				t.Fatalf("filepath.Match(%q) error %v, want error %v", tt.pattern, matchErr, tt.wantPos >= 0)
+			}
+			if tt.wantPos >= 0 {
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("GlobToRegexp(%q) = %q, %v, want ParseError", tt.pattern, expr, err)
+				}
+				if parseErr.Pos != tt.wantPos {
+					t.Errorf("GlobToRegexp(%q) error at %d, want %d", tt.pattern, parseErr.Pos, tt.wantPos)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GlobToRegexp(%q): %v", tt.pattern, err)
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				t.Fatalf("GlobToRegexp(%q) = %q: %v", tt.pattern, expr, err)
+			}
+			var got []string
+			for _, name := range names {
+				if re.MatchString(name) {
+					got = append(got, name)
+				}
+				if ok, _ := filepath.Match(tt.pattern, name); ok != re.MatchString(name) {
+					t.Errorf("%q matches %q: %v, filepath.Match: %v", expr, name, !ok, ok)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%q matches %q, want %q", expr, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lettered/zssld-tools/faults"
+)
+
+// the autorestart settings
+const (
+	AutoRestartAlways     = "true"
+	AutoRestartNever      = "false"
+	AutoRestartUnexpected = "unexpected"
+)
+
+// the special values of the stdout_logfile and stderr_logfile keys, AUTO is
+// the default
+const (
+	LogfileAuto = "AUTO"
+	LogfileNone = "NONE"
+)
+
+// ProgramConfig the typed configuration of a program or event listener process,
+// with the supervisor defaults applied for the missing keys
+type ProgramConfig struct {
+	Name          string
+	Group         string
+	Command       string
+	ProcessName   string
+	NumProcs      int
+	NumProcsStart int
+	ProcessNum    int
+	Priority      int
+	AutoStart     bool
+	StartSecs     int
+	StartRetries  int
+	// AutoRestart one of AutoRestartAlways, AutoRestartNever and AutoRestartUnexpected
+	AutoRestart  string
+	ExitCodes    []int
+	StopSignal   string
+	StopWaitSecs int
+	StopAsGroup  bool
+	KillAsGroup  bool
+	User         string
+	Directory    string
+	Umask        string
+	ServerURL    string
+	DependsOn    []string
+	RestartPause int
+	// Schedule the cron schedule of starting the program, nil if the program
+	// is not scheduled
+	Schedule *CronSchedule
+
+	RedirectStderr bool
+	Stdout         LogConfig
+	Stderr         LogConfig
+
+	// Environment the KEY=value pairs of the environment and envFiles keys
+	Environment []string
+}
+
+// LogConfig the configuration of the stdout or stderr log of a process
+type LogConfig struct {
+	// Logfile the log file, empty if NONE. For AUTO, the log file is created
+	// in the childlogdir of [zssld] with the os.CreateTemp pattern Logfile,
+	// e.g. "/tmp/web-stdout---zssld-*.log", see Auto
+	Logfile         string
+	Auto            bool
+	LogfileMaxBytes int64
+	LogfileBackups  int
+	// LogfileRotate the period the log file is rotated at besides its size,
+	// "hourly", "daily", "weekly" or "none"
+	LogfileRotate   string
+	CaptureMaxBytes int64
+	EventsEnabled   bool
+	Syslog          bool
+}
+
+// collects the errors while decoding the entry
+type entryDecoder struct {
+	entry *Entry
+	errs  ValidationErrors
+}
+
+// record the problem of the key, the problems of the processes of a program
+// are reported for the program section like Validate does
+func (d *entryDecoder) fail(key string, msg string) {
+	d.errs = append(d.errs, ValidationError{Section: d.entry.sectionName(), Key: key, Msg: msg})
+}
+
+func (d *entryDecoder) getInt(key string, defValue int) int {
+	value, ok := d.entry.lookup(key)
+	if !ok {
+		return defValue
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		d.fail(key, fmt.Sprintf("invalid int value %q", value))
+		return defValue
+	}
+	return i
+}
+
+// get the duration value of the key in whole seconds
+func (d *entryDecoder) getSeconds(key string, defValue int) int {
+	value, ok := d.entry.lookup(key)
+	if !ok {
+		return defValue
+	}
+	duration, err := parseDuration(value)
+	if err != nil {
+		d.fail(key, err.Error())
+		return defValue
+	}
+	return int(duration / time.Second)
+}
+
+func (d *entryDecoder) getBool(key string, defValue bool) bool {
+	value, ok := d.entry.lookup(key)
+	if !ok {
+		return defValue
+	}
+	b, err := parseBool(value)
+	if err != nil {
+		d.fail(key, err.Error())
+		return defValue
+	}
+	return b
+}
+
+// get the log rotation period, "none" if not set
+func (d *entryDecoder) getRotate(key string) string {
+	value, ok := d.entry.lookup(key)
+	if !ok {
+		return "none"
+	}
+	rotate, err := parseRotate(value)
+	if err != nil {
+		d.fail(key, err.Error())
+		return "none"
+	}
+	return rotate
+}
+
+func (d *entryDecoder) getBytes(key string, defValue int64) int64 {
+	value, ok := d.entry.lookup(key)
+	if !ok {
+		return defValue
+	}
+	i, err := parseBytes(value)
+	if err != nil {
+		d.fail(key, err.Error())
+		return defValue
+	}
+	return i
+}
+
+// get the log configuration of the stdout or stderr channel of the process,
+// the AUTO log file is named like supervisor does, the AUTO stderr log file is
+// not used if stderr is redirected to stdout
+func (d *entryDecoder) getLogConfig(channel string, processName string, redirected bool) LogConfig {
+	logfile := d.entry.GetStringExpression(channel+"_logfile", LogfileAuto)
+	auto := false
+	switch strings.ToUpper(strings.TrimSpace(logfile)) {
+	case LogfileAuto:
+		logfile = ""
+		if !redirected {
+			auto = true
+			logfile = filepath.Join(d.entry.childLogDir, fmt.Sprintf("%s-%s---%s-*.log", processName, channel, d.entry.identifier))
+		}
+	case LogfileNone:
+		logfile = ""
+	}
+	return LogConfig{
+		Logfile:         logfile,
+		Auto:            auto,
+		LogfileMaxBytes: d.getBytes(channel+"_logfile_maxbytes", 50*1024*1024),
+		LogfileBackups:  d.getInt(channel+"_logfile_backups", 10),
+		LogfileRotate:   d.getRotate(channel + "_logfile_rotate"),
+		CaptureMaxBytes: d.getBytes(channel+"_capture_maxbytes", 0),
+		EventsEnabled:   d.getBool(channel+"_events_enabled", false),
+		Syslog:          d.getBool(channel+"_syslog", false),
+	}
+}
+
+// ToProgramConfig decodes the program or event listener entry to ProgramConfig.
+//
+// All the malformed values are reported in the returned ValidationErrors
+func (c *Entry) ToProgramConfig() (*ProgramConfig, error) {
+	if !c.IsProgram() && !c.IsEventListener() {
+		return nil, faults.NewFault(faults.BadName, fmt.Sprintf("%s is not a program or event listener", c.Name))
+	}
+	d := &entryDecoder{entry: c}
+	name := c.GetProgramName()
+	if c.IsEventListener() {
+		name = c.GetEventListenerName()
+	}
+	pc := &ProgramConfig{
+		Name:          name,
+		Group:         c.Group,
+		Command:       c.GetString("command", ""),
+		ProcessName:   c.GetString("process_name", name),
+		NumProcs:      d.getInt("numprocs", 1),
+		NumProcsStart: d.getInt("numprocs_start", 1),
+		ProcessNum:    d.getInt("process_num", 0),
+		Priority:      d.getInt("priority", defaultPriority),
+		AutoStart:     d.getBool("autostart", true),
+		StartSecs:     d.getSeconds("startsecs", 1),
+		StartRetries:  d.getInt("startretries", 3),
+		AutoRestart:   AutoRestartUnexpected,
+		ExitCodes:     []int{0},
+		StopSignal:    c.GetString("stopsignal", "TERM"),
+		StopWaitSecs:  d.getSeconds("stopwaitsecs", 10),
+		StopAsGroup:   d.getBool("stopasgroup", false),
+		User:          c.GetString("user", ""),
+		Directory:     c.GetStringExpression("directory", ""),
+		Umask:         c.GetString("umask", ""),
+		ServerURL:     c.GetString("serverurl", "AUTO"),
+		DependsOn:     make([]string, 0),
+		RestartPause:  d.getInt("restartpause", 0),
+
+		RedirectStderr: d.getBool("redirect_stderr", false),
+
+		Environment: append(c.GetEnvFromFiles("envFiles"), c.GetEnv("environment")...),
+	}
+	pc.KillAsGroup = d.getBool("killasgroup", pc.StopAsGroup)
+	pc.Stdout = d.getLogConfig("stdout", pc.ProcessName, false)
+	pc.Stderr = d.getLogConfig("stderr", pc.ProcessName, pc.RedirectStderr)
+	if c.Group == "" {
+		pc.Group = name
+	}
+	if strings.TrimSpace(pc.Command) == "" {
+		d.fail("command", "missing command")
+	}
+	if value, ok := c.lookup("autorestart"); ok {
+		if value == AutoRestartUnexpected {
+			pc.AutoRestart = AutoRestartUnexpected
+		} else if b, err := parseBool(value); err == nil {
+			pc.AutoRestart = strconv.FormatBool(b)
+		} else {
+			d.fail("autorestart", fmt.Sprintf("invalid autorestart value %q", value))
+		}
+	}
+	if value, ok := c.lookup("exitcodes"); ok {
+		pc.ExitCodes = make([]int, 0)
+		for _, code := range strings.Split(value, ",") {
+			i, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil {
+				d.fail("exitcodes", fmt.Sprintf("invalid exit code %q", code))
+				continue
+			}
+			pc.ExitCodes = append(pc.ExitCodes, i)
+		}
+	}
+	if _, ok := c.rawLookup("schedule"); ok {
+		schedule, err := c.GetCron("schedule")
+		if err != nil {
+			d.fail("schedule", err.Error())
+		}
+		pc.Schedule = schedule
+	}
+	for _, dep := range c.GetStringArray("depends_on", ",") {
+		if dep = strings.TrimSpace(dep); dep != "" {
+			pc.DependsOn = append(pc.DependsOn, dep)
+		}
+	}
+	if len(d.errs) > 0 {
+		return pc, d.errs
+	}
+	return pc, nil
+}
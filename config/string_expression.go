@@ -5,6 +5,9 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/lettered/zssld-tools/faults"
 )
 
 // StringExpression replace the python String like "%(var)s" to string
@@ -16,22 +19,59 @@ type StringExpression struct {
 func NewStringExpression(envs ...string) *StringExpression {
 	se := &StringExpression{env: make(map[string]string)}
 
-	for _, env := range os.Environ() {
-		t := strings.SplitN(env, "=", 2)
-		se.env["ENV_"+t[0]] = t[1]
-	}
 	n := len(envs)
 	for i := 0; i+1 < n; i += 2 {
 		se.env[envs[i]] = envs[i+1]
 	}
+	return se
 
-	hostname, err := os.Hostname()
-	if err == nil {
-		se.env["host_node_name"] = hostname
-	}
+}
 
-	return se
+var (
+	hostnameOnce      sync.Once
+	cachedHostname    string
+	cachedHostnameErr error
+)
+
+// get the hostname of the host, it is looked up once
+func getHostname() (string, error) {
+	hostnameOnce.Do(func() {
+		cachedHostname, cachedHostnameErr = os.Hostname()
+	})
+	return cachedHostname, cachedHostnameErr
+}
 
+// add the "%(ENV_X)s" variables referenced by expr and not in env with the
+// environment variables of the process, the environment is only looked up for
+// the referenced variables
+func addEnvVars(expr *Expression, env map[string]string) {
+	for _, part := range expr.parts {
+		if _, ok := env[part.varName]; ok || !strings.HasPrefix(part.varName, "ENV_") {
+			continue
+		}
+		if value, ok := os.LookupEnv(strings.TrimPrefix(part.varName, "ENV_")); ok {
+			env[part.varName] = value
+		}
+	}
+}
+
+// expand the "%(ENV_X)s" references in s with the environment variables of
+// the process, the other references and the invalid expressions are kept
+func expandOSEnv(s string) string {
+	if !strings.Contains(s, "%(ENV_") {
+		return s
+	}
+	expr, err := ParseExpression(s)
+	if err != nil {
+		return s
+	}
+	env := make(map[string]string)
+	addEnvVars(expr, env)
+	expanded, err := expr.Expand(env)
+	if err != nil {
+		return s
+	}
+	return expanded
 }
 
 // Add adds environment variable (key,value)
@@ -42,50 +82,121 @@ func (se *StringExpression) Add(key string, value string) *StringExpression {
 
 // Eval substitutes "%(var)s" in given string with evaluated values, and returns resulting string
 func (se *StringExpression) Eval(s string) (string, error) {
-	for {
-		// find variable start indicator
-		start := strings.Index(s, "%(")
+	expr, err := ParseExpression(s)
+	if err != nil {
+		return "", err
+	}
+	addEnvVars(expr, se.env)
+	if _, ok := se.env["host_node_name"]; !ok {
+		if hostname, err := getHostname(); err == nil {
+			se.env["host_node_name"] = hostname
+		}
+	}
+	return expr.Eval(se.env)
+}
 
+// exprPart is a literal text or a variable reference in the expression
+type exprPart struct {
+	literal string
+	varName string
+	flags   string
+	verb    byte
+}
+
+// Expression the parsed python string like "%(var)s"
+type Expression struct {
+	parts []exprPart
+}
+
+// ParseExpression parses the string with "%(var)s" and "%(var)d" references,
+// the flags and width of the python format can be put before the type, e.g. "%(process_num)02d"
+func ParseExpression(s string) (*Expression, error) {
+	expr := &Expression{parts: make([]exprPart, 0)}
+	n := len(s)
+	pos := 0
+	for pos < n {
+		// find variable start indicator
+		start := strings.Index(s[pos:], "%(")
 		if start == -1 {
-			return s, nil
+			expr.parts = append(expr.parts, exprPart{literal: s[pos:]})
+			break
+		}
+		start += pos
+		if start > pos {
+			expr.parts = append(expr.parts, exprPart{literal: s[pos:start]})
 		}
-
-		end := start + 1
-		n := len(s)
 
 		// find variable end indicator
-		for end < n && s[end] != ')' {
-			end++
+		end := strings.IndexByte(s[start:], ')')
+		if end == -1 {
+			return nil, newParseError(s, start, "missing ')' in variable reference")
+		}
+		end += start
+		varName := s[start+2 : end]
+		if varName == "" {
+			return nil, newParseError(s, start, "empty variable name")
 		}
 
 		// find the type of the variable
 		typ := end + 1
-		for typ < n && !((s[typ] >= 'a' && s[typ] <= 'z') || (s[typ] >= 'A' && s[typ] <= 'Z')) {
+		for typ < n && strings.IndexByte("0123456789-+ #.", s[typ]) != -1 {
 			typ++
 		}
+		if typ >= n {
+			return nil, newParseError(s, start, "missing type of variable reference")
+		}
+		if s[typ] != 's' && s[typ] != 'd' {
+			return nil, newParseError(s, typ, fmt.Sprintf("not implement type:%c", s[typ]))
+		}
+		expr.parts = append(expr.parts, exprPart{varName: varName, flags: s[end+1 : typ], verb: s[typ]})
+		pos = typ + 1
+	}
+	return expr, nil
+}
 
-		// evaluate the variable
-		if typ < n {
-			varName := s[start+2 : end]
-
-			varValue, ok := se.env[varName]
-
-			if !ok {
-				return "", fmt.Errorf("fail to find the environment variable %s", varName)
-			}
-			if s[typ] == 'd' {
-				i, err := strconv.Atoi(varValue)
-				if err != nil {
-					return "", fmt.Errorf("can't convert %s to integer", varValue)
-				}
-				s = s[0:start] + fmt.Sprintf("%"+s[end+1:typ+1], i) + s[typ+1:]
-			} else if s[typ] == 's' {
-				s = s[0:start] + varValue + s[typ+1:]
-			} else {
-				return "", fmt.Errorf("not implement type:%v", s[typ])
+// Eval substitutes the variable references in the expression with the values in env
+func (e *Expression) Eval(env map[string]string) (string, error) {
+	var buf strings.Builder
+	for _, part := range e.parts {
+		if part.varName == "" {
+			buf.WriteString(part.literal)
+			continue
+		}
+		varValue, ok := env[part.varName]
+		if !ok {
+			return "", faults.NewFault(faults.BadName, fmt.Sprintf("fail to find the environment variable %s", part.varName))
+		}
+		if part.verb == 'd' {
+			i, err := strconv.Atoi(varValue)
+			if err != nil {
+				return "", faults.NewFault(faults.BadArguments, fmt.Sprintf("can't convert %s to integer", varValue))
 			}
+			fmt.Fprintf(&buf, "%"+part.flags+"d", i)
 		} else {
-			return "", fmt.Errorf("invalid string expression format")
+			fmt.Fprintf(&buf, "%"+part.flags+"s", varValue)
+		}
+	}
+	return buf.String(), nil
+}
+
+// Expand substitutes the variable references found in env and keeps the other
+// references, so the result can be evaluated later with more variables
+func (e *Expression) Expand(env map[string]string) (string, error) {
+	var buf strings.Builder
+	for _, part := range e.parts {
+		if part.varName == "" {
+			buf.WriteString(part.literal)
+			continue
+		}
+		if _, ok := env[part.varName]; !ok {
+			fmt.Fprintf(&buf, "%%(%s)%s%c", part.varName, part.flags, part.verb)
+			continue
+		}
+		s, err := (&Expression{parts: []exprPart{part}}).Eval(env)
+		if err != nil {
+			return "", err
 		}
+		buf.WriteString(s)
 	}
+	return buf.String(), nil
 }
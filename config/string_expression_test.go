@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestStringExpressionEval(t *testing.T) {
+	t.Setenv("ZSSLD_TEST_HOME", "/home/web")
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name  string
+		envs  []string
+		input string
+		want  string
+	}{
+		{"environment", nil, "%(ENV_ZSSLD_TEST_HOME)s/bin", "/home/web/bin"},
+		{"explicit environment", []string{"ENV_ZSSLD_TEST_HOME", "/srv"}, "%(ENV_ZSSLD_TEST_HOME)s", "/srv"},
+		{"hostname", nil, "%(host_node_name)s", hostname},
+		{"explicit hostname", []string{"host_node_name", "web-1"}, "%(host_node_name)s", "web-1"},
+		{"variables", []string{"program_name", "web", "process_num", "2"}, "%(program_name)s_%(process_num)02d", "web_02"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewStringExpression(tt.envs...).Eval(tt.input)
+			if err != nil {
+				t.Fatalf("Eval(%q): %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+	if got, err := NewStringExpression().Eval("%(ENV_ZSSLD_TEST_UNSET)s"); err == nil {
+		t.Errorf("Eval of an unset environment variable = %q, want error", got)
+	}
+	if got := expandOSEnv("%(ENV_ZSSLD_TEST_HOME)s/%(program_name)s"); got != "/home/web/%(program_name)s" {
+		t.Errorf("expandOSEnv = %q, want %q", got, "/home/web/%(program_name)s")
+	}
+}
@@ -0,0 +1,100 @@
+// Package faults defines the error codes shared by the zssld packages.
+//
+// The codes are the same as the supervisor XML-RPC fault codes, so they can be
+// returned to the RPC clients and mapped to the ctl exit codes without translation
+package faults
+
+import "errors"
+
+// FaultCode the code of a fault
+type FaultCode int
+
+// the supervisor fault codes
+const (
+	UnknownMethod        FaultCode = 1
+	IncorrectParameters  FaultCode = 2
+	BadArguments         FaultCode = 3
+	SignatureUnsupported FaultCode = 4
+	Shutdown             FaultCode = 6
+	BadName              FaultCode = 10
+	BadSignal            FaultCode = 11
+	NoFile               FaultCode = 20
+	NotExecutable        FaultCode = 21
+	Failed               FaultCode = 30
+	AbnormalTermination  FaultCode = 40
+	SpawnError           FaultCode = 50
+	AlreadyStarted       FaultCode = 60
+	NotRunning           FaultCode = 70
+	Success              FaultCode = 80
+	AlreadyAdded         FaultCode = 90
+	StillRunning         FaultCode = 91
+	CantReread           FaultCode = 92
+)
+
+var codeNames = map[FaultCode]string{
+	UnknownMethod:        "UNKNOWN_METHOD",
+	IncorrectParameters:  "INCORRECT_PARAMETERS",
+	BadArguments:         "BAD_ARGUMENTS",
+	SignatureUnsupported: "SIGNATURE_UNSUPPORTED",
+	Shutdown:             "SHUTDOWN_STATE",
+	BadName:              "BAD_NAME",
+	BadSignal:            "BAD_SIGNAL",
+	NoFile:               "NO_FILE",
+	NotExecutable:        "NOT_EXECUTABLE",
+	Failed:               "FAILED",
+	AbnormalTermination:  "ABNORMAL_TERMINATION",
+	SpawnError:           "SPAWN_ERROR",
+	AlreadyStarted:       "ALREADY_STARTED",
+	NotRunning:           "NOT_RUNNING",
+	Success:              "SUCCESS",
+	AlreadyAdded:         "ALREADY_ADDED",
+	StillRunning:         "STILL_RUNNING",
+	CantReread:           "CANT_REREAD",
+}
+
+// String returns the supervisor name of the code, e.g. "NO_FILE"
+func (code FaultCode) String() string {
+	if name, ok := codeNames[code]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// Coder is implemented by the errors carrying a fault code
+type Coder interface {
+	FaultCode() FaultCode
+}
+
+// Fault an error with fault code and description
+type Fault struct {
+	Code        FaultCode
+	Description string
+}
+
+// NewFault creates a Fault error
+func NewFault(code FaultCode, desc string) error {
+	return &Fault{Code: code, Description: desc}
+}
+
+// Error returns the description of the fault
+func (f *Fault) Error() string {
+	return f.Description
+}
+
+// FaultCode returns the code of the fault
+func (f *Fault) FaultCode() FaultCode {
+	return f.Code
+}
+
+// Code returns the fault code of err: Success for nil, the code carried by err
+// (or any error it wraps) if there is one, otherwise Failed
+func Code(err error) FaultCode {
+	if err == nil {
+		return Success
+	}
+	var coder Coder
+	if errors.As(err, &coder) {
+		return coder.FaultCode()
+	}
+	return Failed
+}
@@ -3,8 +3,11 @@ module github.com/lettered/zssld-tools
 go 1.20
 
 require (
-	github.com/hashicorp/go-envparse v0.1.0 // indirect
-	github.com/ochinchina/go-ini v1.0.1 // indirect
-	github.com/sirupsen/logrus v1.9.3 // indirect
-	golang.org/x/sys v0.18.0 // indirect
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/hashicorp/go-envparse v0.1.0
+	github.com/ochinchina/go-ini v1.0.1
+	github.com/sirupsen/logrus v1.9.3
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.18.0 // indirect
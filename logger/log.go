@@ -1,17 +1,21 @@
 package logger
 
 import (
+	"context"
 	"io"
 	"strings"
 	"sync"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // Logger the log interface to log program stdout/stderr logs to file
 type Logger interface {
 	io.WriteCloser
 	SetPid(pid int)
-	ReadLog(offset int64, length int64) (string, error)
-	ReadTailLog(offset int64, length int64) (string, int64, bool, error)
+	ReadLog(ctx context.Context, offset int64, length int64) (string, error)
+	ReadTailLog(ctx context.Context, offset int64, length int64) (string, int64, bool, error)
+	ReadTailLines(ctx context.Context, lines int) (string, error)
 	ClearCurLogFile() error
 	ClearAllLogFile() error
 }
@@ -58,7 +62,16 @@ func NewNullLogEventEmitter() *NullLogEventEmitter {
 func (ne *NullLogEventEmitter) emitLogEvent(data string) {
 }
 
-// NewLogger creates logger for a program with parameters
+// NewLogger creates logger for a program with parameters.
+//
+// The locker synchronizes the first log file of the program, pass nil to give
+// it a lock of its own. Every other log file always gets its own lock, so
+// unrelated loggers never serialize each other's writes.
+//
+// The log files are also rotated by time if the "logfile_rotate" prop is
+// "hourly", "daily" or "weekly", see NewRotatingFileLogger. The props of a
+// program log are returned by config.Entry.GetLogProps, which maps the
+// stdout_logfile_rotate and stderr_logfile_rotate keys to "logfile_rotate"
 func NewLogger(programName string, logFile string, locker sync.Locker, maxBytes int64, backups int, props map[string]string, logEventEmitter LogEventEmitter) Logger {
 	files := splitLogFile(logFile)
 	loggers := make([]Logger, 0)
@@ -67,7 +80,7 @@ func NewLogger(programName string, logFile string, locker sync.Locker, maxBytes
 		if i == 0 {
 			lr = createLogger(programName, f, locker, maxBytes, backups, props, logEventEmitter)
 		} else {
-			lr = createLogger(programName, f, NewNullLocker(), maxBytes, backups, props, NewNullLogEventEmitter())
+			lr = createLogger(programName, f, nil, maxBytes, backups, props, NewNullLogEventEmitter())
 		}
 		loggers = append(loggers, lr)
 	}
@@ -83,6 +96,7 @@ func splitLogFile(logFile string) []string {
 }
 
 func createLogger(programName string, logFile string, locker sync.Locker, maxBytes int64, backups int, props map[string]string, logEventEmitter LogEventEmitter) Logger {
+	logFile = deviceLogFile(logFile)
 	if logFile == "/dev/stdout" {
 		return NewStdoutLogger(logEventEmitter)
 	}
@@ -97,7 +111,11 @@ func createLogger(programName string, logFile string, locker sync.Locker, maxByt
 	}
 
 	if len(logFile) > 0 {
-		return NewFileLogger(logFile, maxBytes, backups, logEventEmitter, locker)
+		rotate, err := ParseRotatePolicy(props["logfile_rotate"])
+		if err != nil {
+			log.WithFields(log.Fields{log.ErrorKey: err, "program": programName, "logfile": logFile}).Warn("invalid log rotation period, rotate by size only")
+		}
+		return NewRotatingFileLogger(logFile, maxBytes, backups, rotate, logEventEmitter, locker)
 	}
 	return NewNullLogger(logEventEmitter)
 }
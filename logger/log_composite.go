@@ -1,10 +1,14 @@
 package logger
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 // CompositeLogger dispatch the log message to other loggers
 type CompositeLogger struct {
-	lock    sync.Mutex
+	// protects the loggers slice, every logger synchronizes its own writes
+	lock    sync.RWMutex
 	loggers []Logger
 }
 
@@ -34,8 +38,8 @@ func (cl *CompositeLogger) RemoveLogger(logger Logger) {
 
 // Write dispatches log data to the loggers in CompositeLogger pool
 func (cl *CompositeLogger) Write(p []byte) (n int, err error) {
-	cl.lock.Lock()
-	defer cl.lock.Unlock()
+	cl.lock.RLock()
+	defer cl.lock.RUnlock()
 
 	for i, logger := range cl.loggers {
 		if i == 0 {
@@ -64,30 +68,42 @@ func (cl *CompositeLogger) Close() (err error) {
 
 // SetPid sets pid to all loggers in CompositeLogger pool
 func (cl *CompositeLogger) SetPid(pid int) {
-	cl.lock.Lock()
-	defer cl.lock.Unlock()
+	cl.lock.RLock()
+	defer cl.lock.RUnlock()
 
 	for _, logger := range cl.loggers {
 		logger.SetPid(pid)
 	}
 }
 
+// get the first logger in CompositeLogger pool
+func (cl *CompositeLogger) firstLogger() Logger {
+	cl.lock.RLock()
+	defer cl.lock.RUnlock()
+	return cl.loggers[0]
+}
+
 // ReadLog read log data from first logger in CompositeLogger pool
-func (cl *CompositeLogger) ReadLog(offset int64, length int64) (string, error) {
-	return cl.loggers[0].ReadLog(offset, length)
+func (cl *CompositeLogger) ReadLog(ctx context.Context, offset int64, length int64) (string, error) {
+	return cl.firstLogger().ReadLog(ctx, offset, length)
 }
 
 // ReadTailLog tail the log data from first logger in CompositeLogger pool
-func (cl *CompositeLogger) ReadTailLog(offset int64, length int64) (string, int64, bool, error) {
-	return cl.loggers[0].ReadTailLog(offset, length)
+func (cl *CompositeLogger) ReadTailLog(ctx context.Context, offset int64, length int64) (string, int64, bool, error) {
+	return cl.firstLogger().ReadTailLog(ctx, offset, length)
+}
+
+// ReadTailLines reads the last lines from first logger in CompositeLogger pool
+func (cl *CompositeLogger) ReadTailLines(ctx context.Context, lines int) (string, error) {
+	return cl.firstLogger().ReadTailLines(ctx, lines)
 }
 
 // ClearCurLogFile clear the first logger file in CompositeLogger pool
 func (cl *CompositeLogger) ClearCurLogFile() error {
-	return cl.loggers[0].ClearCurLogFile()
+	return cl.firstLogger().ClearCurLogFile()
 }
 
 // ClearAllLogFile clear all the files of first logger in CompositeLogger pool
 func (cl *CompositeLogger) ClearAllLogFile() error {
-	return cl.loggers[0].ClearAllLogFile()
+	return cl.firstLogger().ClearAllLogFile()
 }
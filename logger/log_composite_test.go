@@ -0,0 +1,28 @@
+package logger
+
+import (
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func BenchmarkCompositeLoggerParallel(b *testing.B) {
+	fileLogger := NewFileLogger(filepath.Join(b.TempDir(), "web.log"), 50*1024*1024, 2, NewNullLogEventEmitter(), &sync.Mutex{})
+	cl := NewCompositeLogger([]Logger{fileLogger, NewNullLogger(NewNullLogEventEmitter())})
+	defer cl.Close()
+	line := []byte("2026-10-16 00:00:00,000 INFO the composite logger benchmark line\n")
+
+	// about 100 goroutines writing at the same time
+	b.SetParallelism((100 + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+	b.SetBytes(int64(len(line)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := cl.Write(line); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
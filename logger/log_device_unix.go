@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package logger
+
+// the log file names are used as they are except on Windows
+func deviceLogFile(logFile string) string {
+	return logFile
+}
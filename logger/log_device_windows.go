@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package logger
+
+import "strings"
+
+// map the Windows device names of the log file to the "/dev/" names, "NUL"
+// discards the log and "CON" writes it to the console
+func deviceLogFile(logFile string) string {
+	switch strings.ToUpper(logFile) {
+	case "NUL":
+		return "/dev/null"
+	case "CON", "CONOUT$":
+		return "/dev/stdout"
+	}
+	return logFile
+}
@@ -1,28 +1,78 @@
 package logger
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/lettered/zssld-tools/faults"
 )
 
+// size of the blocks used to read the log files
+const readBlockSize = 32 * 1024
+
+// maximum number of bytes returned by one ReadLog or ReadTailLog call
+const maxTailLength = 1024 * 1024
+
+// pool of the blocks used to read the log files
+var readBlockPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, readBlockSize)
+		return &b
+	},
+}
+
 // FileLogger log program stdout/stderr to file
 type FileLogger struct {
 	name            string
 	maxSize         int64
 	backups         int
+	rotate          RotatePolicy
 	fileSize        int64
 	file            *os.File
 	logEventEmitter LogEventEmitter
 	locker          sync.Locker
+
+	// the time the content of the file starts at, the file is rotated by time
+	// at nextRotate
+	started    time.Time
+	nextRotate time.Time
 }
 
-// NewFileLogger creates FileLogger object
+// NewFileLogger creates FileLogger object. If locker is nil, the logger uses its own lock.
+//
+// The file is not rotated if maxSize is not greater than 0, and it is truncated
+// without keeping backups on rotation if backups is not greater than 0
 func NewFileLogger(name string, maxSize int64, backups int, logEventEmitter LogEventEmitter, locker sync.Locker) *FileLogger {
+	return NewRotatingFileLogger(name, maxSize, backups, RotateNone, logEventEmitter, locker)
+}
+
+// NewRotatingFileLogger creates FileLogger object rotating the file at the
+// start of every period of rotate as well as once it reaches maxSize, e.g. at
+// midnight for RotateDaily. The file is rotated by whichever comes first.
+//
+// The rotated files are named with the UTC timestamp their content starts at,
+// e.g. "web.log.20261016-000000", rather than numbered like the files rotated
+// only by size. The file is rotated by time on the first write of a period, so
+// an idle file keeps the content of the last period until it is written again
+func NewRotatingFileLogger(name string, maxSize int64, backups int, rotate RotatePolicy, logEventEmitter LogEventEmitter, locker sync.Locker) *FileLogger {
+	if locker == nil {
+		locker = &sync.Mutex{}
+	}
+	if maxSize < 0 {
+		maxSize = 0
+	}
+	if backups < 0 {
+		backups = 0
+	}
 	logger := &FileLogger{name: name,
 		maxSize:         maxSize,
 		backups:         backups,
+		rotate:          rotate,
 		fileSize:        0,
 		file:            nil,
 		logEventEmitter: logEventEmitter,
@@ -45,11 +95,17 @@ func (l *FileLogger) openFile(trunc bool) error {
 	fileInfo, err := os.Stat(l.name)
 
 	if trunc || err != nil {
+		l.fileSize = 0
+		l.started = time.Now()
 		l.file, err = os.Create(l.name)
 	} else {
+		// the content of the existing file starts in the period it was last
+		// written, so the file of an earlier period is rotated on first write
 		l.fileSize = fileInfo.Size()
+		l.started = l.rotate.periodStart(fileInfo.ModTime())
 		l.file, err = os.OpenFile(l.name, os.O_RDWR|os.O_APPEND, 0666)
 	}
+	l.nextRotate = l.rotate.nextPeriod(l.started)
 	if err != nil {
 		fmt.Printf("Fail to open log file --%s-- with error %v\n", l.name, err)
 	}
@@ -57,6 +113,13 @@ func (l *FileLogger) openFile(trunc bool) error {
 }
 
 func (l *FileLogger) backupFiles() {
+	if l.backups <= 0 {
+		return
+	}
+	if l.rotate != RotateNone {
+		l.backupTimestampedFiles()
+		return
+	}
 	for i := l.backups - 1; i > 0; i-- {
 		src := fmt.Sprintf("%s.%d", l.name, i)
 		dest := fmt.Sprintf("%s.%d", l.name, i+1)
@@ -73,7 +136,10 @@ func (l *FileLogger) ClearCurLogFile() error {
 	l.locker.Lock()
 	defer l.locker.Unlock()
 
-	return l.openFile(true)
+	if err := l.openFile(true); err != nil {
+		return faults.NewFault(faults.Failed, err.Error())
+	}
+	return nil
 }
 
 // ClearAllLogFile clears contents of all log files (re-open with truncate)
@@ -87,43 +153,59 @@ func (l *FileLogger) ClearAllLogFile() error {
 		if err == nil {
 			err = os.Remove(logFile)
 			if err != nil {
-				return err //faults.NewFault(faults.Failed, err.Error())
+				return faults.NewFault(faults.Failed, err.Error())
 			}
 		}
 	}
+	for _, logFile := range l.rotatedFiles() {
+		if err := os.Remove(logFile); err != nil {
+			return faults.NewFault(faults.Failed, err.Error())
+		}
+	}
 	err := l.openFile(true)
 	if err != nil {
-		return err //faults.NewFault(faults.Failed, err.Error())
+		return faults.NewFault(faults.Failed, err.Error())
 	}
 	return nil
 }
 
-// ReadLog reads log from current logfile
-func (l *FileLogger) ReadLog(offset int64, length int64) (string, error) {
-	if offset < 0 && length != 0 {
-		return "", errors.New("BAD_ARGUMENTS") //faults.NewFault(faults.BadArguments, "BAD_ARGUMENTS")
-	}
-	if offset >= 0 && length < 0 {
-		return "", errors.New("BAD_ARGUMENTS") //faults.NewFault(faults.BadArguments, "BAD_ARGUMENTS")
-	}
-
+// open current log file for reading and get its length.
+//
+// The lock is only held while opening, the opened file stays readable even if
+// the log file is rotated meanwhile, so reads don't block writes
+func (l *FileLogger) openForRead() (*os.File, int64, error) {
 	l.locker.Lock()
 	defer l.locker.Unlock()
-	f, err := os.Open(l.name)
 
+	f, err := os.Open(l.name)
 	if err != nil {
-		return "", errors.New("FAILED") //faults.NewFault(faults.Failed, "FAILED")
+		return nil, 0, err
 	}
-	defer f.Close()
-
-	// check the length of file
 	statInfo, err := f.Stat()
 	if err != nil {
-		return "", errors.New("FAILED") //faults.NewFault(faults.Failed, "FAILED")
+		f.Close()
+		return nil, 0, err
+	}
+	return f, statInfo.Size(), nil
+}
+
+// ReadLog reads log from current logfile, at most maxTailLength bytes are
+// returned
+func (l *FileLogger) ReadLog(ctx context.Context, offset int64, length int64) (string, error) {
+	if offset < 0 && length != 0 {
+		return "", faults.NewFault(faults.BadArguments, "BAD_ARGUMENTS")
+	}
+	if offset >= 0 && length < 0 {
+		return "", faults.NewFault(faults.BadArguments, "BAD_ARGUMENTS")
 	}
 
-	fileLen := statInfo.Size()
+	f, fileLen, err := l.openForRead()
+	if err != nil {
+		return "", faults.NewFault(faults.Failed, "FAILED")
+	}
+	defer f.Close()
 
+	fromEnd := offset < 0
 	if offset < 0 { // offset < 0 && length == 0
 		offset = fileLen + offset
 		if offset < 0 {
@@ -149,41 +231,36 @@ func (l *FileLogger) ReadLog(offset int64, length int64) (string, error) {
 		}
 	}
 
-	b := make([]byte, length)
-	n, err := f.ReadAt(b, offset)
+	// only the tail of a too large range is read if the offset is from the
+	// end of the file, and only the head of the other too large ranges
+	if length > maxTailLength {
+		if fromEnd {
+			offset += length - maxTailLength
+		}
+		length = maxTailLength
+	}
+	data, err := readRange(ctx, f, offset, offset+length)
 	if err != nil {
-		return "", errors.New("FAILED") //faults.NewFault(faults.Failed, "FAILED")
+		return "", err
 	}
-	return string(b[:n]), nil
+	return data, nil
 }
 
 // ReadTailLog tails current log file
-func (l *FileLogger) ReadTailLog(offset int64, length int64) (string, int64, bool, error) {
+func (l *FileLogger) ReadTailLog(ctx context.Context, offset int64, length int64) (string, int64, bool, error) {
 	if offset < 0 {
-		return "", offset, false, fmt.Errorf("offset should not be less than 0")
+		return "", offset, false, faults.NewFault(faults.BadArguments, "offset should not be less than 0")
 	}
 	if length < 0 {
-		return "", offset, false, fmt.Errorf("length should be not be less than 0")
+		return "", offset, false, faults.NewFault(faults.BadArguments, "length should not be less than 0")
 	}
-	l.locker.Lock()
-	defer l.locker.Unlock()
-
-	// open the file
-	f, err := os.Open(l.name)
+	// open the file and get the length of file
+	f, fileLen, err := l.openForRead()
 	if err != nil {
-		return "", 0, false, err
+		return "", 0, false, faults.NewFault(faults.Failed, err.Error())
 	}
-
 	defer f.Close()
 
-	// get the length of file
-	statInfo, err := f.Stat()
-	if err != nil {
-		return "", 0, false, err
-	}
-
-	fileLen := statInfo.Size()
-
 	// check if offset exceeds the length of file
 	if offset >= fileLen {
 		return "", fileLen, true, nil
@@ -194,13 +271,111 @@ func (l *FileLogger) ReadTailLog(offset int64, length int64) (string, int64, boo
 		length = fileLen - offset
 	}
 
-	b := make([]byte, length)
-	n, err := f.ReadAt(b, offset)
+	// only the tail of a too large range is read, the skipped data is reported as overflow
+	start := offset
+	overflow := false
+	if length > maxTailLength {
+		start = offset + length - maxTailLength
+		overflow = true
+	}
+	data, err := readRange(ctx, f, start, offset+length)
 	if err != nil {
 		return "", offset, false, err
 	}
-	return string(b[:n]), offset + int64(n), false, nil
+	return data, start + int64(len(data)), overflow, nil
+
+}
+
+// ReadTailLines reads the last lines of current log file
+func (l *FileLogger) ReadTailLines(ctx context.Context, lines int) (string, error) {
+	if lines <= 0 {
+		return "", faults.NewFault(faults.BadArguments, "BAD_ARGUMENTS")
+	}
+	f, fileLen, err := l.openForRead()
+	if err != nil {
+		return "", faults.NewFault(faults.Failed, "FAILED")
+	}
+	defer f.Close()
+
+	start, err := findLinesStart(ctx, f, fileLen, lines)
+	if err != nil {
+		return "", err
+	}
+	data, err := readRange(ctx, f, start, fileLen)
+	if err != nil {
+		return "", err
+	}
+	return data, nil
+}
+
+// read the bytes between offset and end of file f forwards in fixed-size
+// blocks into a buffer of the size of the returned data, so no more than the
+// returned data and one pooled block are allocated.
+//
+// The error of ctx is returned if it is done before the reading completes
+func readRange(ctx context.Context, f *os.File, offset int64, end int64) (string, error) {
+	blockPtr := readBlockPool.Get().(*[]byte)
+	defer readBlockPool.Put(blockPtr)
+	block := *blockPtr
+
+	var buf strings.Builder
+	buf.Grow(int(end - offset))
+	for pos := offset; pos < end; {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n := int64(len(block))
+		if end-pos < n {
+			n = end - pos
+		}
+		m, err := f.ReadAt(block[:n], pos)
+		buf.Write(block[:m])
+		pos += int64(m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", faults.NewFault(faults.Failed, err.Error())
+		}
+	}
+	return buf.String(), nil
+}
 
+// find the offset of the last lines lines of the first end bytes of file f,
+// the file is scanned backwards in fixed-size blocks without keeping them.
+//
+// The error of ctx is returned if it is done before the scanning completes
+func findLinesStart(ctx context.Context, f *os.File, end int64, lines int) (int64, error) {
+	blockPtr := readBlockPool.Get().(*[]byte)
+	defer readBlockPool.Put(blockPtr)
+	block := *blockPtr
+
+	newlines := 0
+	for pos := end; pos > 0; {
+		n := int64(len(block))
+		if pos < n {
+			n = pos
+		}
+		pos -= n
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		m, err := f.ReadAt(block[:n], pos)
+		if err != nil && err != io.EOF {
+			return 0, faults.NewFault(faults.Failed, err.Error())
+		}
+		for i := m - 1; i >= 0; i-- {
+			// the newline terminating the last line does not start another line
+			if block[i] != '\n' || pos+int64(i) == end-1 {
+				continue
+			}
+			newlines++
+			if newlines == lines {
+				return pos + int64(i) + 1, nil
+			}
+		}
+	}
+	return 0, nil
 }
 
 // Write overrides function in io.Writer. Write log message to the file
@@ -208,6 +383,14 @@ func (l *FileLogger) Write(p []byte) (int, error) {
 	l.locker.Lock()
 	defer l.locker.Unlock()
 
+	if now := time.Now(); l.rotate != RotateNone && !now.Before(l.nextRotate) {
+		// an empty file is kept for the new period rather than rotated
+		if l.fileSize > 0 {
+			l.rotateFile()
+		}
+		l.started = l.rotate.periodStart(now)
+		l.nextRotate = l.rotate.nextPeriod(now)
+	}
 	n, err := l.file.Write(p)
 
 	if err != nil {
@@ -215,6 +398,9 @@ func (l *FileLogger) Write(p []byte) (int, error) {
 	}
 	l.logEventEmitter.emitLogEvent(string(p))
 	l.fileSize += int64(n)
+	if l.maxSize <= 0 {
+		return n, err
+	}
 	if l.fileSize >= l.maxSize {
 		fileInfo, errStat := os.Stat(l.name)
 		if errStat == nil {
@@ -224,13 +410,18 @@ func (l *FileLogger) Write(p []byte) (int, error) {
 		}
 	}
 	if l.fileSize >= l.maxSize {
-		l.Close()
-		l.backupFiles()
-		l.openFile(true)
+		l.rotateFile()
 	}
 	return n, err
 }
 
+// rotate the log file, it is truncated if there are no backups
+func (l *FileLogger) rotateFile() {
+	l.Close()
+	l.backupFiles()
+	l.openFile(true)
+}
+
 // Close file logger
 func (l *FileLogger) Close() error {
 	if l.file != nil {
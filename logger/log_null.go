@@ -1,8 +1,9 @@
 package logger
 
 import (
-	"errors"
-	"fmt"
+	"context"
+
+	"github.com/lettered/zssld-tools/faults"
 )
 
 // NullLogger discard the program stdout/stderr log
@@ -32,21 +33,26 @@ func (l *NullLogger) Close() error {
 }
 
 // ReadLog returns error for NullLogger
-func (l *NullLogger) ReadLog(offset int64, length int64) (string, error) {
-	return "", errors.New("NO_FILE") //faults.NewFault(faults.NoFile, "NO_FILE")
+func (l *NullLogger) ReadLog(ctx context.Context, offset int64, length int64) (string, error) {
+	return "", faults.NewFault(faults.NoFile, "NO_FILE")
 }
 
 // ReadTailLog returns error for NullLogger
-func (l *NullLogger) ReadTailLog(offset int64, length int64) (string, int64, bool, error) {
-	return "", 0, false, errors.New("NO_FILE") //faults.NewFault(faults.NoFile, "NO_FILE")
+func (l *NullLogger) ReadTailLog(ctx context.Context, offset int64, length int64) (string, int64, bool, error) {
+	return "", 0, false, faults.NewFault(faults.NoFile, "NO_FILE")
+}
+
+// ReadTailLines returns error for NullLogger
+func (l *NullLogger) ReadTailLines(ctx context.Context, lines int) (string, error) {
+	return "", faults.NewFault(faults.NoFile, "NO_FILE")
 }
 
 // ClearCurLogFile returns error for NullLogger
 func (l *NullLogger) ClearCurLogFile() error {
-	return fmt.Errorf("No log")
+	return faults.NewFault(faults.NoFile, "NO_FILE")
 }
 
 // ClearAllLogFile returns error for NullLogger
 func (l *NullLogger) ClearAllLogFile() error {
-	return errors.New("NO_FILE") //faults.NewFault(faults.NoFile, "NO_FILE")
+	return faults.NewFault(faults.NoFile, "NO_FILE")
 }
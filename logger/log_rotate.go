@@ -0,0 +1,163 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RotatePolicy the period a FileLogger rotates its log file at, besides
+// rotating it once it reaches its maximum size
+type RotatePolicy int
+
+const (
+	// RotateNone the log file is only rotated by size
+	RotateNone RotatePolicy = iota
+	// RotateHourly the log file is rotated at the start of every hour
+	RotateHourly
+	// RotateDaily the log file is rotated at midnight
+	RotateDaily
+	// RotateWeekly the log file is rotated at midnight between Sunday and Monday
+	RotateWeekly
+)
+
+// the layout of the timestamps of the rotated log files. The timestamps are
+// in UTC so they sort in the order the log files are started, the local time
+// repeats an hour when the daylight saving time ends
+const rotateTimeLayout = "20060102-150405"
+
+// ParseRotatePolicy parses the "rotate" value "hourly", "daily" or "weekly",
+// the empty value and "none" are RotateNone
+func ParseRotatePolicy(s string) (RotatePolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none":
+		return RotateNone, nil
+	case "hourly":
+		return RotateHourly, nil
+	case "daily":
+		return RotateDaily, nil
+	case "weekly":
+		return RotateWeekly, nil
+	}
+	return RotateNone, fmt.Errorf("invalid rotate value %q, must be hourly, daily, weekly or none", s)
+}
+
+// String returns the "rotate" value of the policy, e.g. "daily"
+func (p RotatePolicy) String() string {
+	switch p {
+	case RotateHourly:
+		return "hourly"
+	case RotateDaily:
+		return "daily"
+	case RotateWeekly:
+		return "weekly"
+	default:
+		return "none"
+	}
+}
+
+// the start of the rotation period containing t in the location of t
+func (p RotatePolicy) periodStart(t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch p {
+	case RotateHourly:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	case RotateDaily:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case RotateWeekly:
+		// the weeks start on Monday
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location())
+	}
+	return t
+}
+
+// the start of the rotation period following the period containing t
+func (p RotatePolicy) nextPeriod(t time.Time) time.Time {
+	start := p.periodStart(t)
+	year, month, day := start.Date()
+	switch p {
+	case RotateHourly:
+		return time.Date(year, month, day, start.Hour()+1, 0, 0, 0, start.Location())
+	case RotateDaily:
+		return time.Date(year, month, day+1, 0, 0, 0, 0, start.Location())
+	case RotateWeekly:
+		return time.Date(year, month, day+7, 0, 0, 0, 0, start.Location())
+	}
+	return start
+}
+
+// a log file rotated with the timestamp of its start, the files started in
+// the same second are numbered, e.g. "web.log.20261016-000000.1"
+type rotatedFile struct {
+	name  string
+	stamp string
+	num   int
+}
+
+// parse the name of the log file rotated from the log file base
+func parseRotatedFile(base string, name string) (rotatedFile, bool) {
+	if !strings.HasPrefix(name, base+".") {
+		return rotatedFile{}, false
+	}
+	result := rotatedFile{name: name, stamp: name[len(base)+1:]}
+	if pos := strings.IndexByte(result.stamp, '.'); pos != -1 {
+		num, err := strconv.Atoi(result.stamp[pos+1:])
+		if err != nil || num <= 0 {
+			return rotatedFile{}, false
+		}
+		result.stamp, result.num = result.stamp[:pos], num
+	}
+	if _, err := time.Parse(rotateTimeLayout, result.stamp); err != nil {
+		return rotatedFile{}, false
+	}
+	return result, true
+}
+
+// get the log files rotated with timestamps from the oldest to the newest
+func (l *FileLogger) rotatedFiles() []string {
+	dir, base := filepath.Split(l.name)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil
+	}
+	files := make([]rotatedFile, 0)
+	for _, entry := range entries {
+		if f, ok := parseRotatedFile(base, entry.Name()); ok && entry.Type().IsRegular() {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].stamp != files[j].stamp {
+			return files[i].stamp < files[j].stamp
+		}
+		return files[i].num < files[j].num
+	})
+	result := make([]string, len(files))
+	for i, f := range files {
+		result[i] = filepath.Join(dir, f.name)
+	}
+	return result
+}
+
+// rename the log file to its name with the timestamp of its start and remove
+// the oldest rotated log files exceeding the backups
+func (l *FileLogger) backupTimestampedFiles() {
+	stamp := l.started.UTC().Format(rotateTimeLayout)
+	dest := l.name + "." + stamp
+	for i := 1; ; i++ {
+		if _, err := os.Stat(dest); os.IsNotExist(err) {
+			break
+		}
+		dest = fmt.Sprintf("%s.%s.%d", l.name, stamp, i)
+	}
+	os.Rename(l.name, dest)
+	files := l.rotatedFiles()
+	for len(files) > l.backups {
+		os.Remove(files[0])
+		files = files[1:]
+	}
+}
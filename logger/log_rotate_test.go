@@ -0,0 +1,32 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackupTimestampedFilesDST(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "web.log")
+	l := &FileLogger{name: name, backups: 3}
+	edt, est := time.FixedZone("EDT", -4*3600), time.FixedZone("EST", -5*3600)
+	// the local time repeats 01:00-02:00 when the daylight saving time ends
+	starts := []time.Time{
+		time.Date(2026, 11, 1, 1, 30, 0, 0, edt),
+		time.Date(2026, 11, 1, 1, 10, 0, 0, est),
+		time.Date(2026, 11, 1, 1, 10, 0, 0, est),
+	}
+	for _, started := range starts {
+		if err := os.WriteFile(name, []byte("log\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		l.started = started
+		l.backupTimestampedFiles()
+	}
+	want := []string{name + ".20261101-053000", name + ".20261101-061000", name + ".20261101-061000.1"}
+	if got := l.rotatedFiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rotatedFiles() = %q, want %q", got, want)
+	}
+}